@@ -0,0 +1,24 @@
+package builder
+
+import "billiemuk/internal/templates"
+
+// buildArchive groups posts by year and month. posts must already be sorted
+// newest first, and the groups keep that order.
+func buildArchive(posts []templates.PostData) []templates.ArchiveYear {
+	var years []templates.ArchiveYear
+	for _, p := range posts {
+		year, month := p.Date.Year(), p.Date.Month()
+
+		if len(years) == 0 || years[len(years)-1].Year != year {
+			years = append(years, templates.ArchiveYear{Year: year})
+		}
+		y := &years[len(years)-1]
+
+		if len(y.Months) == 0 || y.Months[len(y.Months)-1].Month != month {
+			y.Months = append(y.Months, templates.ArchiveMonth{Month: month})
+		}
+		m := &y.Months[len(y.Months)-1]
+		m.Posts = append(m.Posts, p)
+	}
+	return years
+}
@@ -0,0 +1,34 @@
+package builder
+
+import (
+	"testing"
+	"time"
+
+	"billiemuk/internal/templates"
+)
+
+func TestBuildArchive(t *testing.T) {
+	date := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+	posts := []templates.PostData{
+		{Slug: "c", Date: date(2026, time.February, 3)},
+		{Slug: "b", Date: date(2026, time.January, 20)},
+		{Slug: "a", Date: date(2026, time.January, 5)},
+		{Slug: "old", Date: date(2025, time.December, 1)},
+	}
+
+	archive := buildArchive(posts)
+
+	if len(archive) != 2 {
+		t.Fatalf("got %d years, want 2", len(archive))
+	}
+	if archive[0].Year != 2026 || archive[1].Year != 2025 {
+		t.Errorf("years = %d, %d, want 2026, 2025", archive[0].Year, archive[1].Year)
+	}
+	months := archive[0].Months
+	if len(months) != 2 || months[0].Month != time.February || months[1].Month != time.January {
+		t.Fatalf("2026 months = %v, want February, January", months)
+	}
+	if len(months[1].Posts) != 2 || months[1].Posts[0].Slug != "b" {
+		t.Errorf("January posts = %v, want b then a", months[1].Posts)
+	}
+}
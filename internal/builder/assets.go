@@ -0,0 +1,212 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"billiemuk/internal/templates"
+
+	"github.com/tdewolff/minify/v2"
+	"github.com/tdewolff/minify/v2/css"
+	mhtml "github.com/tdewolff/minify/v2/html"
+	"github.com/tdewolff/minify/v2/js"
+	mjson "github.com/tdewolff/minify/v2/json"
+	"github.com/tdewolff/minify/v2/svg"
+	"github.com/tdewolff/minify/v2/xml"
+)
+
+// AssetConfig controls how files in static/ are published.
+//
+// Patterns ending in "/" match a directory and everything below it,
+// patterns containing "/" match the whole path relative to static/, and
+// other patterns match the file name, using path.Match syntax.
+type AssetConfig struct {
+	// Minify maps lowercase file extensions to the media type of the
+	// minifier applied to them.
+	Minify map[string]string
+	// PassThrough lists files copied unchanged even when their extension
+	// has a minifier, such as already-minified vendor files.
+	PassThrough []string
+	// Exclude lists files that are never published, such as sources.
+	Exclude []string
+
+	// sanitizeSVG is set from Config.SanitizeSVG.
+	sanitizeSVG bool
+}
+
+func DefaultAssetConfig() AssetConfig {
+	return AssetConfig{
+		Minify: map[string]string{
+			".css":  "text/css",
+			".js":   "application/javascript",
+			".svg":  mediaSVG,
+			".json": "application/json",
+		},
+		PassThrough: []string{"*.min.*"},
+		Exclude:     []string{"scss/", "*.scss", "*.map"},
+	}
+}
+
+// withDefaults fills each nil field of c from DefaultAssetConfig. Set a
+// field to an empty, non-nil value to turn its defaults off.
+func (c AssetConfig) withDefaults() AssetConfig {
+	d := DefaultAssetConfig()
+	if c.Minify == nil {
+		c.Minify = d.Minify
+	}
+	if c.PassThrough == nil {
+		c.PassThrough = d.PassThrough
+	}
+	if c.Exclude == nil {
+		c.Exclude = d.Exclude
+	}
+	return c
+}
+
+// Asset actions recorded in the build report.
+const (
+	AssetMinified = "minify"
+	AssetCopied   = "copy"
+	AssetExcluded = "exclude"
+)
+
+// AssetResult describes what happened to one file from static/. Output is
+// the published path relative to dist/ and is empty for excluded files.
+type AssetResult struct {
+	Source      string `json:"source"`
+	Output      string `json:"output"`
+	Action      string `json:"action"`
+	SourceBytes int    `json:"source_bytes"`
+	Bytes       int    `json:"bytes"`
+}
+
+// newMinifier returns a minifier with every supported media type
+// registered. HTML keeps quotes and document tags so the output stays valid
+// for strict parsers; scripts and styles embedded in HTML, including
+// JSON-LD, are minified by their own media type.
+func newMinifier() *minify.M {
+	m := minify.New()
+	m.AddFunc("text/css", css.Minify)
+	m.Add("text/html", &mhtml.Minifier{KeepDocumentTags: true, KeepQuotes: true})
+	m.AddFuncRegexp(regexp.MustCompile(`^(application|text)/(x-)?(java|ecma)script$`), js.Minify)
+	m.AddFunc(mediaSVG, svg.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`[/+]json$`), mjson.Minify)
+	m.AddFuncRegexp(regexp.MustCompile(`[/+]xml$`), xml.Minify)
+	return m
+}
+
+// assetManifest maps static file names to their published names. Hidden
+// files are never published, so it can't clash with a static file.
+const assetManifest = "static/.assets.json"
+
+// processStatic publishes static files into dist/static according to cfg,
+// using up to jobs workers. Each file is written under a content-hashed
+// name for templates to link with asset, and under its own name for
+// references that can't be rewritten, such as url() in stylesheets and
+// favicons. It writes the name mapping to dist/static/.assets.json and
+// returns it along with a per-file report in path order.
+func processStatic(ctx context.Context, jobs int, staticDirs []string, out *output, cfg AssetConfig) (map[string]templates.Asset, []AssetResult, error) {
+	cfg = cfg.withDefaults()
+	m := newMinifier()
+
+	files, names, err := layeredFiles(staticDirs...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	results := make([]AssetResult, len(names))
+	published := make([]templates.Asset, len(names))
+	tasks := make([]func(context.Context) error, len(names))
+	for i, rel := range names {
+		tasks[i] = func(context.Context) error {
+			var err error
+			results[i], published[i], err = publishAsset(rel, files[rel], cfg, m, out)
+			return err
+		}
+	}
+	if err := runTasks(ctx, jobs, tasks); err != nil {
+		return nil, nil, err
+	}
+
+	assets := make(map[string]templates.Asset)
+	for i, r := range results {
+		if r.Action != AssetExcluded {
+			assets[r.Source] = published[i]
+		}
+	}
+
+	manifest, err := encodeManifest(assets)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode manifest: %w", err)
+	}
+	if err := out.write(assetManifest, mediaRaw, []byte(manifest)); err != nil {
+		return nil, nil, err
+	}
+	return assets, results, nil
+}
+
+// publishAsset minifies, copies or excludes a single static file.
+func publishAsset(rel, srcPath string, cfg AssetConfig, m *minify.M, out *output) (AssetResult, templates.Asset, error) {
+	if matchAny(cfg.Exclude, rel) {
+		return AssetResult{Source: rel, Action: AssetExcluded}, templates.Asset{}, nil
+	}
+
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return AssetResult{}, templates.Asset{}, err
+	}
+	result := AssetResult{Source: rel, Action: AssetCopied, SourceBytes: len(data)}
+
+	if strings.ToLower(path.Ext(rel)) == ".svg" {
+		if data, err = prepareSVG(data, cfg.sanitizeSVG); err != nil {
+			return AssetResult{}, templates.Asset{}, fmt.Errorf("%s: %w", rel, err)
+		}
+	}
+
+	mediatype, ok := cfg.Minify[strings.ToLower(path.Ext(rel))]
+	if ok && !matchAny(cfg.PassThrough, rel) {
+		minified, err := m.Bytes(mediatype, data)
+		if err != nil {
+			return AssetResult{}, templates.Asset{}, fmt.Errorf("minify %s: %w", rel, err)
+		}
+		data = minified
+		result.Action = AssetMinified
+	}
+
+	asset := fingerprint(rel, data)
+	result.Output = "static/" + asset.Path
+	result.Bytes = len(data)
+	if err := out.write(result.Output, mediaRaw, data); err != nil {
+		return AssetResult{}, templates.Asset{}, err
+	}
+	if err := out.write("static/"+rel, mediaRaw, data); err != nil {
+		return AssetResult{}, templates.Asset{}, err
+	}
+	return result, asset, nil
+}
+
+// matchAny reports whether rel, a slash-separated path, matches any of the
+// AssetConfig patterns.
+func matchAny(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		switch {
+		case strings.HasSuffix(p, "/"):
+			if strings.HasPrefix(rel, p) {
+				return true
+			}
+		case strings.Contains(p, "/"):
+			if ok, _ := path.Match(p, rel); ok {
+				return true
+			}
+		default:
+			if ok, _ := path.Match(p, path.Base(rel)); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
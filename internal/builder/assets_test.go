@@ -0,0 +1,131 @@
+package builder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"billiemuk/internal/dist"
+)
+
+func TestProcessStaticPipeline(t *testing.T) {
+	root := t.TempDir()
+	staticDir := filepath.Join(root, "static")
+	distDir := filepath.Join(root, "dist")
+
+	files := map[string]string{
+		"css/theme.css":     ":root {\n  color: red;\n}\n",
+		"css/theme.min.css": ":root{color:red}",
+		"js/app.js":         "function add(a, b) {\n  return a + b;\n}\n",
+		"scss/theme.scss":   "body { color: red; }",
+		"fonts/a.woff2":     "font",
+		"manifest.json":     `{"name":"Blog"}`,
+	}
+	for name, data := range files {
+		if err := writeFile(filepath.Join(staticDir, name), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assets, results, err := processStatic(context.Background(), 0, []string{staticDir}, newOutput(dist.Dir(distDir), false), AssetConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions := make(map[string]string)
+	for _, r := range results {
+		actions[r.Source] = r.Action
+	}
+	want := map[string]string{
+		"css/theme.css":     AssetMinified,
+		"css/theme.min.css": AssetCopied,
+		"js/app.js":         AssetMinified,
+		"scss/theme.scss":   AssetExcluded,
+		"fonts/a.woff2":     AssetCopied,
+	}
+	for src, action := range want {
+		if actions[src] != action {
+			t.Errorf("%s action = %q, want %q", src, actions[src], action)
+		}
+	}
+
+	if _, ok := assets["css/theme.min.min.css"]; ok {
+		t.Error("checked-in theme.min.css was minified again")
+	}
+	if _, ok := assets["scss/theme.scss"]; ok {
+		t.Error("excluded scss source was published")
+	}
+
+	data, err := os.ReadFile(filepath.Join(distDir, "static", assets["css/theme.min.css"].Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != ":root{color:red}" {
+		t.Errorf("theme.min.css = %q, want copied unchanged", data)
+	}
+	data, err = os.ReadFile(filepath.Join(distDir, "static", assets["css/theme.css"].Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != ":root{color:red}" {
+		t.Errorf("theme.css = %q, want minified", data)
+	}
+
+	// Unhashed copies serve url() references and hard-coded links
+	data, err = os.ReadFile(filepath.Join(distDir, "static", "css", "theme.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != ":root{color:red}" {
+		t.Errorf("unhashed theme.css = %q, want minified", data)
+	}
+	if _, err := os.Stat(filepath.Join(distDir, "static", "fonts", "a.woff2")); err != nil {
+		t.Errorf("unhashed font not published: %v", err)
+	}
+	data, err = os.ReadFile(filepath.Join(distDir, "static", "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"name":"Blog"}` {
+		t.Errorf("manifest.json = %q, overwritten by the asset manifest", data)
+	}
+}
+
+func TestAssetConfigDefaultsPerField(t *testing.T) {
+	cfg := AssetConfig{PassThrough: []string{"vendor/"}}.withDefaults()
+	if len(cfg.PassThrough) != 1 || cfg.PassThrough[0] != "vendor/" {
+		t.Errorf("PassThrough = %q, want the configured value", cfg.PassThrough)
+	}
+	if !matchAny(cfg.Exclude, "scss/theme.scss") || !matchAny(cfg.Exclude, "css/theme.css.map") {
+		t.Errorf("Exclude = %q, want the defaults", cfg.Exclude)
+	}
+	if cfg.Minify[".css"] == "" {
+		t.Error("Minify lost its defaults")
+	}
+
+	// An empty, non-nil field turns its defaults off
+	cfg = AssetConfig{Exclude: []string{}}.withDefaults()
+	if len(cfg.Exclude) != 0 {
+		t.Errorf("Exclude = %q, want none", cfg.Exclude)
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	tests := []struct {
+		pattern, rel string
+		want         bool
+	}{
+		{"scss/", "scss/theme.scss", true},
+		{"scss/", "css/scss/x.css", false},
+		{"*.min.*", "css/theme.min.css", true},
+		{"*.min.*", "css/theme.css", false},
+		{"css/*.css", "css/theme.css", true},
+		{"css/*.css", "vendor/css/theme.css", false},
+	}
+	for _, tt := range tests {
+		if got := matchAny([]string{tt.pattern}, tt.rel); got != tt.want {
+			t.Errorf("matchAny(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.want)
+		}
+	}
+}
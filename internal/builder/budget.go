@@ -0,0 +1,153 @@
+package builder
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Budget limits the size of built output, in bytes. Zero disables a limit.
+type Budget struct {
+	// MaxPageBytes limits each HTML page on its own.
+	MaxPageBytes int
+	// MaxImageBytes limits each file under images/.
+	MaxImageBytes int
+	// MaxPageWeight limits each HTML page plus the local stylesheets,
+	// scripts and images it references, each counted once.
+	MaxPageWeight int
+}
+
+func (b Budget) isZero() bool {
+	return b == Budget{}
+}
+
+// BudgetViolation is a file that exceeds one of the budget's limits.
+type BudgetViolation struct {
+	Path  string `json:"path"`
+	Limit string `json:"limit"`
+	Bytes int    `json:"bytes"`
+	Max   int    `json:"max"`
+}
+
+// BudgetError lists every file over budget.
+type BudgetError struct {
+	Violations []BudgetViolation
+}
+
+func (e *BudgetError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d files over budget:", len(e.Violations))
+	for _, v := range e.Violations {
+		fmt.Fprintf(&b, "\n  %s: %s is %s (max %s)", v.Path, v.Limit, formatBytes(int64(v.Bytes)), formatBytes(int64(v.Max)))
+	}
+	return b.String()
+}
+
+// Matches the URL attributes of elements that add to a page's weight. The
+// HTML minifier keeps attribute quotes, so only quoted values are handled.
+var (
+	subresourceRe = regexp.MustCompile(`<(?:img|script|source)\b[^>]*?\ssrc="([^"]*)"`)
+	linkRe        = regexp.MustCompile(`<link\b[^>]*>`)
+	stylesheetRe  = regexp.MustCompile(`\srel="?stylesheet"?`)
+	hrefRe        = regexp.MustCompile(`\shref="([^"]*)"`)
+)
+
+// CheckBudget checks the files in a build report against cfg.Budget,
+// reading pages back from the build output to find what they reference.
+// It records the offenders in report.BudgetViolations and returns a
+// *BudgetError listing them when any limit is exceeded.
+func CheckBudget(cfg Config, report *Report) error {
+	b := cfg.Budget
+	if b.isZero() {
+		return nil
+	}
+
+	dst := cfg.output()
+	sizes := make(map[string]int, len(report.Files))
+	for _, f := range report.Files {
+		sizes[f.Path] = f.Bytes
+	}
+
+	var pages, images, weights []BudgetViolation
+	for _, f := range report.Files {
+		isPage := path.Ext(f.Path) == ".html"
+		if isPage && b.MaxPageBytes > 0 && f.Bytes > b.MaxPageBytes {
+			pages = append(pages, BudgetViolation{f.Path, "page size", f.Bytes, b.MaxPageBytes})
+		}
+		if isImageOutput(f.Path) && b.MaxImageBytes > 0 && f.Bytes > b.MaxImageBytes {
+			images = append(images, BudgetViolation{f.Path, "image size", f.Bytes, b.MaxImageBytes})
+		}
+		if isPage && b.MaxPageWeight > 0 {
+			html, err := fs.ReadFile(dst, f.Path)
+			if err != nil {
+				return fmt.Errorf("budget: %w", err)
+			}
+			weight := f.Bytes
+			for _, ref := range pageResources(f.Path, string(html), cfg.Site.BaseURL) {
+				weight += sizes[ref]
+			}
+			if weight > b.MaxPageWeight {
+				weights = append(weights, BudgetViolation{f.Path, "page weight", weight, b.MaxPageWeight})
+			}
+		}
+	}
+
+	violations := append(append(pages, images...), weights...)
+	report.BudgetViolations = violations
+	if len(violations) > 0 {
+		return &BudgetError{Violations: violations}
+	}
+	return nil
+}
+
+// pageResources returns the dist paths of the local stylesheets, scripts
+// and images referenced by the page at pagePath, without duplicates.
+func pageResources(pagePath, html, baseURL string) []string {
+	var refs []string
+	for _, m := range subresourceRe.FindAllStringSubmatch(html, -1) {
+		refs = append(refs, m[1])
+	}
+	for _, link := range linkRe.FindAllString(html, -1) {
+		if !stylesheetRe.MatchString(link) {
+			continue
+		}
+		if m := hrefRe.FindStringSubmatch(link); m != nil {
+			refs = append(refs, m[1])
+		}
+	}
+
+	base, _ := url.Parse(baseURL)
+	seen := make(map[string]bool)
+	var paths []string
+	for _, ref := range refs {
+		p, ok := localPath(pagePath, ref, base)
+		if ok && !seen[p] {
+			seen[p] = true
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// localPath resolves a URL found in the page at pagePath to a path in the
+// dist directory. URLs on other hosts are not local.
+func localPath(pagePath, ref string, base *url.URL) (string, bool) {
+	u, err := url.Parse(ref)
+	if err != nil || u.Scheme == "data" {
+		return "", false
+	}
+	if u.Host != "" && (base == nil || u.Host != base.Host) {
+		return "", false
+	}
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		return path.Join(path.Dir(pagePath), p), true
+	}
+	if base != nil {
+		p = strings.TrimPrefix(p, strings.TrimRight(base.Path, "/"))
+	}
+	return strings.TrimPrefix(path.Clean(p), "/"), true
+}
@@ -0,0 +1,84 @@
+package builder
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"billiemuk/internal/dist"
+	"billiemuk/internal/templates"
+)
+
+func TestCheckBudget(t *testing.T) {
+	distDir := t.TempDir()
+	out := newOutput(dist.Dir(distDir), false)
+	page := `<html><head><link rel="stylesheet" href="/blog/static/css/theme.css"></head>` +
+		`<body><img src="/blog/images/big.png"><img src="../../images/big.png"><img src="https://cdn.example.org/x.png"></body></html>`
+	for _, f := range []struct {
+		path string
+		data string
+	}{
+		{"posts/hello/index.html", page},
+		{"static/css/theme.css", strings.Repeat("a", 300)},
+		{"images/big.png", strings.Repeat("b", 2000)},
+		{"images/small.png", "c"},
+	} {
+		if err := out.write(f.path, mediaRaw, []byte(f.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	report := &Report{}
+	report.finish(out.written(), time.Now())
+
+	cfg := Config{
+		DistDir: distDir,
+		Site:    templates.SiteData{BaseURL: "https://example.com/blog"},
+		Budget:  Budget{MaxImageBytes: 1000, MaxPageWeight: 2500},
+	}
+	err := CheckBudget(cfg, report)
+	var budgetErr *BudgetError
+	if !errors.As(err, &budgetErr) {
+		t.Fatalf("CheckBudget() = %v, want *BudgetError", err)
+	}
+
+	want := []BudgetViolation{
+		{"images/big.png", "image size", 2000, 1000},
+		{"posts/hello/index.html", "page weight", len(page) + 300 + 2000, 2500},
+	}
+	if !reflect.DeepEqual(budgetErr.Violations, want) {
+		t.Errorf("violations = %+v, want %+v", budgetErr.Violations, want)
+	}
+	if !strings.Contains(err.Error(), "images/big.png: image size") {
+		t.Errorf("error does not list offenders: %v", err)
+	}
+	if !reflect.DeepEqual(report.BudgetViolations, want) {
+		t.Errorf("report violations = %+v, want %+v", report.BudgetViolations, want)
+	}
+	var buf bytes.Buffer
+	if err := report.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"budget_violations"`) || !strings.Contains(buf.String(), `"limit": "page weight"`) {
+		t.Errorf("JSON report missing budget violations:\n%s", buf.String())
+	}
+
+	cfg.Budget = Budget{MaxPageBytes: 10000, MaxImageBytes: 5000, MaxPageWeight: 10000}
+	if err := CheckBudget(cfg, report); err != nil {
+		t.Errorf("CheckBudget() within budget = %v", err)
+	}
+	if len(report.BudgetViolations) != 0 {
+		t.Errorf("report violations within budget = %+v", report.BudgetViolations)
+	}
+}
+
+func TestCheckBudgetZeroIsUnlimited(t *testing.T) {
+	report := &Report{Files: []OutputFile{{Path: "index.html", Bytes: 1 << 30}}}
+	if err := CheckBudget(Config{DistDir: filepath.Join(os.TempDir(), "missing")}, report); err != nil {
+		t.Errorf("CheckBudget() with no budget = %v", err)
+	}
+}
@@ -1,49 +1,157 @@
 package builder
 
 import (
+	"context"
 	"fmt"
 	"html/template"
+	"log"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"billiemuk/internal/content"
+	"billiemuk/internal/dist"
 	"billiemuk/internal/templates"
-
-	"github.com/tdewolff/minify/v2"
-	"github.com/tdewolff/minify/v2/css"
-	mhtml "github.com/tdewolff/minify/v2/html"
 )
 
 type Config struct {
-	ContentDir    string
-	TemplatesDir  string
-	StaticDir     string
-	DistDir       string
+	ContentDir   string
+	TemplatesDir string
+	StaticDir    string
+	DistDir      string
+	// ThemeDir optionally points at a theme with its own templates/ and
+	// static/ directories. Site files override theme files of the same name.
+	ThemeDir string
+	// Output receives the built files instead of DistDir when set, e.g. a
+	// dist.Mem for the dev server. It should start empty.
+	Output        dist.Writer
 	Site          templates.SiteData
 	IncludeDrafts bool
 	DevMode       bool
+	// SCSS controls checking or compiling static/scss before static files
+	// are processed. SCSSLoadPaths are passed to sass (e.g. node_modules).
+	SCSS          SCSSMode
+	SCSSLoadPaths []string
+	// Assets controls minification and exclusion of static files. Nil
+	// fields use DefaultAssetConfig.
+	Assets AssetConfig
+	// SanitizeSVG strips scripts, foreign objects and event handlers from
+	// SVGs in static/ and content/images. SVGs are always checked to be
+	// well-formed.
+	SanitizeSVG bool
+	// Minify minifies generated HTML, XML and JSON. It is ignored in dev
+	// mode so output stays readable while debugging.
+	Minify bool
+	// Precompress writes .gz and .br siblings for text files of at least
+	// PrecompressMinSize bytes (DefaultPrecompressMinSize when zero).
+	Precompress        bool
+	PrecompressMinSize int
+	// Jobs bounds how many pages, static files and images are processed
+	// at once. Zero means one per CPU.
+	Jobs int
+	// Images controls resizing and re-encoding of content/images.
+	Images ImageConfig
+	// Budget limits output sizes; see CheckBudget.
+	Budget Budget
+}
+
+// output returns where the build writes files: cfg.Output, or DistDir.
+func (cfg Config) output() dist.Writer {
+	if cfg.Output != nil {
+		return cfg.Output
+	}
+	return dist.Dir(cfg.DistDir)
+}
+
+// Build renders the site into cfg.DistDir, or cfg.Output when set, and
+// reports what was published. DistDir is only replaced once the whole
+// build succeeds; a failed build leaves the previous output in place.
+func Build(cfg Config) (*Report, error) {
+	return BuildContext(context.Background(), cfg)
 }
 
-func Build(cfg Config) error {
-	// Clean dist
-	if err := os.RemoveAll(cfg.DistDir); err != nil {
-		return fmt.Errorf("clean dist: %w", err)
+// BuildContext is Build with a context that aborts the build when
+// cancelled.
+func BuildContext(ctx context.Context, cfg Config) (*Report, error) {
+	report := &Report{}
+	start := time.Now()
+	phaseStart := start
+
+	// Build into a fresh directory beside dist, moved into place at the end
+	dst := cfg.Output
+	if dst == nil {
+		tmp, err := newDistDir(cfg.DistDir)
+		if err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(tmp)
+		dst = dist.Dir(tmp)
 	}
 
-	// Parse posts
+	out := newOutput(dst, cfg.Minify && !cfg.DevMode)
+	out.precompress = cfg.Precompress
+	out.precompressMin = cfg.PrecompressMinSize
+	if out.precompressMin == 0 {
+		out.precompressMin = DefaultPrecompressMinSize
+	}
+
+	cfg.Images.sanitizeSVG = cfg.SanitizeSVG
+	cfg.Assets.sanitizeSVG = cfg.SanitizeSVG
+
+	// Process images first so posts can refer to their sizes and posters
+	images, err := processImages(ctx, cfg.Jobs, cfg.ContentDir, out, cfg.Images)
+	if err != nil {
+		return nil, fmt.Errorf("process images: %w", err)
+	}
+	phaseStart = report.phase("images", phaseStart)
+
+	// Parse posts, counting the drafts left out
 	postsDir := filepath.Join(cfg.ContentDir, "posts")
-	posts, err := content.ParseAllPosts(postsDir, cfg.IncludeDrafts)
+	allPosts, err := content.ParseAllPostsWith(postsDir, content.Options{IncludeDrafts: true, Images: images})
 	if err != nil {
-		return fmt.Errorf("parse posts: %w", err)
+		return nil, fmt.Errorf("parse posts: %w", err)
 	}
+	var posts []content.Post
+	for _, p := range allPosts {
+		if p.Draft && !cfg.IncludeDrafts {
+			report.DraftsSkipped++
+			continue
+		}
+		posts = append(posts, p)
+	}
+	report.Posts = len(posts)
+	phaseStart = report.phase("parse", phaseStart)
 
 	// Load templates
-	renderer, err := templates.New(cfg.TemplatesDir)
+	renderer, err := templates.New(cfg.Site.BaseURL, cfg.themeDir("templates"), cfg.TemplatesDir)
 	if err != nil {
-		return fmt.Errorf("load templates: %w", err)
+		return nil, fmt.Errorf("load templates: %w", err)
 	}
+	renderer.Images = images
+	phaseStart = report.phase("templates", phaseStart)
+
+	// Check compiled CSS is up to date with its SCSS sources
+	warning, err := checkSCSS(cfg.SCSS, cfg.StaticDir, cfg.SCSSLoadPaths)
+	if err != nil {
+		return nil, fmt.Errorf("scss: %w", err)
+	}
+	if warning != "" {
+		log.Printf("warning: %s", warning)
+		report.Warnings = append(report.Warnings, warning)
+	}
+	phaseStart = report.phase("scss", phaseStart)
+
+	// Process static assets (minify, copy or exclude) with fingerprinted names
+	assets, assetResults, err := processStatic(ctx, cfg.Jobs, []string{cfg.themeDir("static"), cfg.StaticDir}, out, cfg.Assets)
+	if err != nil {
+		return nil, fmt.Errorf("process static: %w", err)
+	}
+	renderer.Assets = assets
+	report.Assets = assetResults
+	phaseStart = report.phase("static", phaseStart)
 
 	// Convert posts to template data
 	var postDataList []templates.PostData
@@ -53,93 +161,164 @@ func Build(cfg Config) error {
 			Date:        p.Date,
 			Summary:     p.Summary,
 			Slug:        p.Slug,
+			Tags:        p.Tags,
 			Draft:       p.Draft,
 			HTMLContent: template.HTML(p.HTML),
 		})
 	}
 
-	// Render homepage
-	homeData := templates.PageData{
+	// Link multi-part series
+	series := groupSeries(posts, postDataList)
+
+	// Collect every page, then render them in parallel
+	var pages []page
+
+	pages = append(pages, page{"index.html", "home", "home", templates.PageData{
 		Site:    cfg.Site,
 		Posts:   postDataList,
 		DevMode: cfg.DevMode,
-	}
-	homeHTML, err := renderer.RenderHome(homeData)
-	if err != nil {
-		return fmt.Errorf("render home: %w", err)
-	}
-	if err := writeFile(filepath.Join(cfg.DistDir, "index.html"), homeHTML); err != nil {
-		return err
-	}
+	}})
 
-	// Render each post
-	for _, pd := range postDataList {
-		pd := pd
+	// Posts with their neighbours and related posts
+	related := relatedPosts(posts)
+	for i := range postDataList {
+		pd := postDataList[i]
 		postData := templates.PageData{
-			Site:    cfg.Site,
-			Post:    &pd,
-			DevMode: cfg.DevMode,
+			Site:      cfg.Site,
+			Post:      &pd,
+			DevMode:   cfg.DevMode,
+			GIFPlayer: posts[i].HasAnimations,
 		}
-		postHTML, err := renderer.RenderPost(postData)
-		if err != nil {
-			return fmt.Errorf("render post %s: %w", pd.Slug, err)
+		if i+1 < len(postDataList) {
+			postData.PrevPost = &postDataList[i+1]
+		}
+		if i > 0 {
+			postData.NextPost = &postDataList[i-1]
 		}
-		postDir := filepath.Join(cfg.DistDir, "posts", pd.Slug)
-		if err := writeFile(filepath.Join(postDir, "index.html"), postHTML); err != nil {
-			return err
+		for _, j := range related[i] {
+			postData.Related = append(postData.Related, postDataList[j])
 		}
+		layout := posts[i].Layout
+		if layout == "" {
+			layout = "post"
+		}
+		pages = append(pages, page{"posts/" + pd.Slug + "/index.html", "post " + pd.Slug, layout, postData})
 	}
 
-	// Process static assets (copy + minify CSS)
-	if err := processStatic(cfg.StaticDir, cfg.DistDir); err != nil {
-		return fmt.Errorf("process static: %w", err)
+	// Series index pages
+	for _, sd := range series {
+		pages = append(pages, page{"series/" + sd.Slug + "/index.html", "series " + sd.Slug, "series", templates.PageData{
+			Site:    cfg.Site,
+			Series:  sd,
+			DevMode: cfg.DevMode,
+		}})
 	}
 
-	// Process images
-	if err := processImages(cfg.ContentDir, cfg.DistDir); err != nil {
-		return fmt.Errorf("process images: %w", err)
+	// Archive and per-year pages
+	archive := buildArchive(postDataList)
+	pages = append(pages, page{"archive/index.html", "archive", "archive", templates.PageData{
+		Site:    cfg.Site,
+		Title:   "Archive",
+		Path:    "/archive/",
+		Archive: archive,
+		DevMode: cfg.DevMode,
+	}})
+	for _, year := range archive {
+		name := strconv.Itoa(year.Year)
+		pages = append(pages, page{name + "/index.html", "archive " + name, "archive", templates.PageData{
+			Site:    cfg.Site,
+			Title:   name,
+			Path:    "/" + name + "/",
+			Archive: []templates.ArchiveYear{year},
+			DevMode: cfg.DevMode,
+		}})
 	}
 
+	if err := renderPages(ctx, cfg.Jobs, renderer, out, pages); err != nil {
+		return nil, err
+	}
+	phaseStart = report.phase("render", phaseStart)
+
 	// Generate SEO files
-	if err := generateSEO(cfg, posts); err != nil {
-		return fmt.Errorf("generate SEO: %w", err)
+	if err := generateSEO(cfg, out, posts); err != nil {
+		return nil, fmt.Errorf("generate SEO: %w", err)
 	}
+	report.phase("seo", phaseStart)
 
-	return nil
+	if tmp, ok := dst.(dist.Dir); ok {
+		if err := replaceDir(cfg.DistDir, string(tmp)); err != nil {
+			return nil, fmt.Errorf("publish dist: %w", err)
+		}
+	}
+
+	report.finish(out.written(), start)
+	return report, nil
 }
 
-func processStatic(staticDir, distDir string) error {
-	m := minify.New()
-	m.AddFunc("text/css", css.Minify)
-	m.AddFunc("text/html", mhtml.Minify)
+// newDistDir creates an empty directory to build into next to distDir, so
+// it can be renamed over distDir.
+func newDistDir(distDir string) (string, error) {
+	parent := filepath.Dir(distDir)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return "", fmt.Errorf("create dist: %w", err)
+	}
+	tmp, err := os.MkdirTemp(parent, "."+filepath.Base(distDir)+"-*")
+	if err != nil {
+		return "", fmt.Errorf("create dist: %w", err)
+	}
+	if err := os.Chmod(tmp, 0755); err != nil {
+		os.RemoveAll(tmp)
+		return "", fmt.Errorf("create dist: %w", err)
+	}
+	return tmp, nil
+}
 
-	return filepath.Walk(staticDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return err
-		}
+// replaceDir moves the directory src to dst, replacing whatever was there.
+// If the move fails the previous dst is restored.
+func replaceDir(dst, src string) error {
+	old := src + ".old"
+	if err := os.Rename(dst, old); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		os.Rename(old, dst)
+		return err
+	}
+	return os.RemoveAll(old)
+}
 
-		rel, _ := filepath.Rel(staticDir, path)
-		data, err := os.ReadFile(path)
-		if err != nil {
-			return err
-		}
+// page is a single HTML page to render with a layout.
+type page struct {
+	path   string
+	name   string
+	layout string
+	data   templates.PageData
+}
 
-		// Minify CSS files and rename to .min.css
-		if strings.HasSuffix(path, ".css") {
-			minified, err := m.String("text/css", string(data))
+func renderPages(ctx context.Context, jobs int, renderer *templates.Renderer, out *output, pages []page) error {
+	tasks := make([]func(context.Context) error, len(pages))
+	for i, p := range pages {
+		tasks[i] = func(context.Context) error {
+			html, err := renderer.Render(p.layout, p.data)
 			if err != nil {
-				return fmt.Errorf("minify %s: %w", rel, err)
+				return fmt.Errorf("render %s: %w", p.name, err)
 			}
-			outName := strings.TrimSuffix(rel, ".css") + ".min.css"
-			return writeFile(filepath.Join(distDir, "static", outName), minified)
+			return out.write(p.path, mediaHTML, []byte(html))
 		}
+	}
+	return runTasks(ctx, jobs, tasks)
+}
 
-		// Copy other static files as-is
-		return writeFile(filepath.Join(distDir, "static", rel), string(data))
-	})
+// themeDir returns the named subdirectory of the theme, or "" when no
+// theme is configured.
+func (cfg Config) themeDir(name string) string {
+	if cfg.ThemeDir == "" {
+		return ""
+	}
+	return filepath.Join(cfg.ThemeDir, name)
 }
 
-func generateSEO(cfg Config, posts []content.Post) error {
+func generateSEO(cfg Config, out *output, posts []content.Post) error {
 	// Filter out drafts for SEO
 	var published []content.Post
 	for _, p := range posts {
@@ -153,18 +332,37 @@ func generateSEO(cfg Config, posts []content.Post) error {
 	sitemap.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
 	sitemap.WriteString(`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">` + "\n")
 	sitemap.WriteString(fmt.Sprintf("  <url><loc>%s/</loc></url>\n", cfg.Site.BaseURL))
+	if len(published) > 0 {
+		sitemap.WriteString(fmt.Sprintf("  <url><loc>%s/archive/</loc></url>\n", cfg.Site.BaseURL))
+	}
+	lastYear := 0
+	for _, p := range published {
+		if y := p.Date.Year(); y != lastYear {
+			sitemap.WriteString(fmt.Sprintf("  <url><loc>%s/%d/</loc></url>\n", cfg.Site.BaseURL, y))
+			lastYear = y
+		}
+	}
+	seenSeries := make(map[string]bool)
+	for _, p := range published {
+		slug := content.Slugify(p.Series)
+		if slug == "" || seenSeries[slug] {
+			continue
+		}
+		seenSeries[slug] = true
+		sitemap.WriteString(fmt.Sprintf("  <url><loc>%s/series/%s/</loc></url>\n", cfg.Site.BaseURL, slug))
+	}
 	for _, p := range published {
 		sitemap.WriteString(fmt.Sprintf("  <url><loc>%s/posts/%s/</loc><lastmod>%s</lastmod></url>\n",
 			cfg.Site.BaseURL, p.Slug, p.Date.Format("2006-01-02")))
 	}
 	sitemap.WriteString("</urlset>\n")
-	if err := writeFile(filepath.Join(cfg.DistDir, "sitemap.xml"), sitemap.String()); err != nil {
+	if err := out.write("sitemap.xml", mediaXML, []byte(sitemap.String())); err != nil {
 		return err
 	}
 
 	// robots.txt
 	robots := fmt.Sprintf("User-agent: *\nAllow: /\nSitemap: %s/sitemap.xml\n", cfg.Site.BaseURL)
-	if err := writeFile(filepath.Join(cfg.DistDir, "robots.txt"), robots); err != nil {
+	if err := out.write("robots.txt", mediaRaw, []byte(robots)); err != nil {
 		return err
 	}
 
@@ -190,7 +388,7 @@ func generateSEO(cfg Config, posts []content.Post) error {
 	}
 	feed.WriteString("</channel>\n")
 	feed.WriteString("</rss>\n")
-	if err := writeFile(filepath.Join(cfg.DistDir, "feed.xml"), feed.String()); err != nil {
+	if err := out.write("feed.xml", mediaXML, []byte(feed.String())); err != nil {
 		return err
 	}
 
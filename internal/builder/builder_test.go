@@ -1,11 +1,15 @@
 package builder
 
 import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"billiemuk/internal/dist"
 	"billiemuk/internal/templates"
 )
 
@@ -37,21 +41,15 @@ This is my **first** post.
 		t.Fatal(err)
 	}
 
-	// Copy real templates from project root
-	for _, name := range []string{"base.html", "home.html", "post.html"} {
-		src, err := os.ReadFile(filepath.Join("..", "..", "templates", name))
-		if err != nil {
-			t.Fatalf("read template %s: %v", name, err)
-		}
-		if err := os.WriteFile(filepath.Join(templatesDir, name), src, 0644); err != nil {
-			t.Fatal(err)
-		}
-	}
+	copyTemplates(t, templatesDir)
 
-	// Create a minimal theme.css
+	// Create a minimal theme.css and its checked-in minified build
 	if err := os.WriteFile(filepath.Join(staticDir, "theme.css"), []byte(":root { color: red; }"), 0644); err != nil {
 		t.Fatal(err)
 	}
+	if err := os.WriteFile(filepath.Join(staticDir, "theme.min.css"), []byte(":root{color:red}"), 0644); err != nil {
+		t.Fatal(err)
+	}
 
 	cfg := Config{
 		ContentDir:   filepath.Join(root, "content"),
@@ -68,7 +66,7 @@ This is my **first** post.
 		IncludeDrafts: false,
 	}
 
-	if err := Build(cfg); err != nil {
+	if _, err := Build(cfg); err != nil {
 		t.Fatal(err)
 	}
 
@@ -90,8 +88,200 @@ This is my **first** post.
 		t.Error("post HTML missing content")
 	}
 
-	// Verify minified CSS exists
-	if _, err := os.Stat(filepath.Join(distDir, "static", "css", "theme.min.css")); err != nil {
+	// Verify archive pages exist
+	for _, page := range []string{"archive", "2026"} {
+		if _, err := os.Stat(filepath.Join(distDir, page, "index.html")); err != nil {
+			t.Errorf("%s/index.html not created", page)
+		}
+	}
+
+	// Verify minified CSS exists under its fingerprinted name
+	var manifest map[string]templates.Asset
+	data, err := os.ReadFile(filepath.Join(distDir, "static", ".assets.json"))
+	if err != nil {
+		t.Fatal("asset manifest not created")
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	css, ok := manifest["css/theme.min.css"]
+	if !ok {
+		t.Fatal("manifest missing css/theme.min.css")
+	}
+	if _, err := os.Stat(filepath.Join(distDir, "static", css.Path)); err != nil {
 		t.Error("minified CSS not created")
 	}
+	if !strings.Contains(string(indexHTML), "/static/"+css.Path) {
+		t.Error("index.html does not link fingerprinted CSS")
+	}
+	if !strings.Contains(string(indexHTML), css.Integrity) {
+		t.Error("index.html missing CSS integrity hash")
+	}
+}
+
+func TestBuildIsDeterministicAcrossJobCounts(t *testing.T) {
+	root := t.TempDir()
+	templatesDir := filepath.Join(root, "templates")
+	copyTemplates(t, templatesDir)
+	for i := 1; i <= 6; i++ {
+		post := fmt.Sprintf("---\ntitle: \"Post %d\"\ndate: 2026-01-%02d\ntags: [\"go\"]\n---\n\nBody %d.\n", i, i, i)
+		if err := writeFile(filepath.Join(root, "content", "posts", fmt.Sprintf("2026-01-%02d-post-%d.md", i, i)), post); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeFile(filepath.Join(root, "static", "css", "theme.min.css"), ":root{color:red}"); err != nil {
+		t.Fatal(err)
+	}
+
+	build := func(jobs int) map[string]string {
+		distDir := filepath.Join(root, fmt.Sprintf("dist-%d", jobs))
+		cfg := Config{
+			ContentDir:   filepath.Join(root, "content"),
+			TemplatesDir: templatesDir,
+			StaticDir:    filepath.Join(root, "static"),
+			DistDir:      distDir,
+			Site:         templates.SiteData{Title: "Test", BaseURL: "https://example.com"},
+			Minify:       true,
+			Jobs:         jobs,
+		}
+		if _, err := Build(cfg); err != nil {
+			t.Fatal(err)
+		}
+		files := make(map[string]string)
+		err := filepath.Walk(distDir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			rel, _ := filepath.Rel(distDir, path)
+			data, err := os.ReadFile(path)
+			files[rel] = string(data)
+			return err
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return files
+	}
+
+	serial, parallel := build(1), build(8)
+	if len(serial) != len(parallel) {
+		t.Fatalf("serial build wrote %d files, parallel wrote %d", len(serial), len(parallel))
+	}
+	for name, data := range serial {
+		if parallel[name] != data {
+			t.Errorf("%s differs between serial and parallel builds", name)
+		}
+	}
+}
+
+func TestBuildIntoMemory(t *testing.T) {
+	root := t.TempDir()
+	templatesDir := filepath.Join(root, "templates")
+	copyTemplates(t, templatesDir)
+	post := "---\ntitle: \"Hello\"\ndate: 2026-01-15\n---\n\nBody.\n"
+	if err := writeFile(filepath.Join(root, "content", "posts", "2026-01-15-hello.md"), post); err != nil {
+		t.Fatal(err)
+	}
+
+	distDir := filepath.Join(root, "dist")
+	files := dist.NewMem()
+	cfg := Config{
+		ContentDir:   filepath.Join(root, "content"),
+		TemplatesDir: templatesDir,
+		StaticDir:    filepath.Join(root, "static"),
+		DistDir:      distDir,
+		Output:       files,
+		Site:         templates.SiteData{Title: "Test", BaseURL: "https://example.com"},
+		Budget:       Budget{MaxPageWeight: 1 << 20},
+	}
+	report, err := Build(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckBudget(cfg, report); err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := fs.ReadFile(files, "posts/2026-01-15-hello/index.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "Hello") {
+		t.Errorf("post HTML = %s", html)
+	}
+	if _, err := os.Stat(distDir); !os.IsNotExist(err) {
+		t.Errorf("dist dir written during in-memory build: %v", err)
+	}
+}
+
+func TestFailedBuildKeepsPreviousDist(t *testing.T) {
+	root := t.TempDir()
+	templatesDir := filepath.Join(root, "templates")
+	copyTemplates(t, templatesDir)
+	post := "---\ntitle: \"Hello\"\ndate: 2026-01-15\n---\n\nBody.\n"
+	if err := writeFile(filepath.Join(root, "content", "posts", "2026-01-15-hello.md"), post); err != nil {
+		t.Fatal(err)
+	}
+	distDir := filepath.Join(root, "dist")
+	cfg := Config{
+		ContentDir:   filepath.Join(root, "content"),
+		TemplatesDir: templatesDir,
+		StaticDir:    filepath.Join(root, "static"),
+		DistDir:      distDir,
+		Site:         templates.SiteData{Title: "Test", BaseURL: "https://example.com"},
+	}
+	if _, err := Build(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(distDir, "stale.txt"), "from an earlier build"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Build(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(distDir, "stale.txt")); !os.IsNotExist(err) {
+		t.Error("rebuild kept a file from the previous output")
+	}
+
+	// Break the templates after images and posts have been written
+	if err := os.Remove(filepath.Join(templatesDir, "base.html")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Build(cfg); err == nil {
+		t.Fatal("build without base.html succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(distDir, "posts", "2026-01-15-hello", "index.html")); err != nil {
+		t.Errorf("previous output lost after failed build: %v", err)
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".dist") {
+			t.Errorf("temporary build directory %s left behind", e.Name())
+		}
+	}
+}
+
+// copyTemplates copies the real templates and partials from the project
+// root into dir.
+func copyTemplates(t *testing.T, dir string) {
+	t.Helper()
+	src := filepath.Join("..", "..", "templates")
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return writeFile(filepath.Join(dir, rel), string(data))
+	})
+	if err != nil {
+		t.Fatalf("copy templates: %v", err)
+	}
 }
@@ -0,0 +1,41 @@
+package builder
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"path"
+	"strings"
+
+	"billiemuk/internal/templates"
+)
+
+const fingerprintLen = 8
+
+// fingerprint returns name with a short content hash inserted before its
+// extension (css/theme.min.css -> css/theme.min.3fa9c2d1.css), along with
+// a Subresource Integrity hash of data.
+func fingerprint(name string, data []byte) templates.Asset {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])[:fingerprintLen]
+
+	ext := path.Ext(name)
+	hashed := strings.TrimSuffix(name, ext) + "." + hash + ext
+
+	sri := sha512.Sum384(data)
+	return templates.Asset{
+		Path:      hashed,
+		Integrity: "sha384-" + base64.StdEncoding.EncodeToString(sri[:]),
+	}
+}
+
+// encodeManifest serialises the asset manifest with stable key order.
+func encodeManifest(assets map[string]templates.Asset) (string, error) {
+	b, err := json.MarshalIndent(assets, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
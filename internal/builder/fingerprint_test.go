@@ -0,0 +1,27 @@
+package builder
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	a := fingerprint("css/theme.min.css", []byte("body{color:red}"))
+	b := fingerprint("css/theme.min.css", []byte("body{color:blue}"))
+
+	if !strings.HasPrefix(a.Path, "css/theme.min.") || !strings.HasSuffix(a.Path, ".css") {
+		t.Errorf("path = %q, want css/theme.min.<hash>.css", a.Path)
+	}
+	if len(a.Path) != len("css/theme.min..css")+fingerprintLen {
+		t.Errorf("path = %q, want %d character hash", a.Path, fingerprintLen)
+	}
+	if a.Path == b.Path {
+		t.Error("different content produced the same fingerprint")
+	}
+	if !strings.HasPrefix(a.Integrity, "sha384-") {
+		t.Errorf("integrity = %q, want sha384- prefix", a.Integrity)
+	}
+	if again := fingerprint("css/theme.min.css", []byte("body{color:red}")); again != a {
+		t.Error("fingerprint is not deterministic")
+	}
+}
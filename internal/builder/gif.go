@@ -0,0 +1,110 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/png"
+	"os"
+	"path"
+	"strings"
+
+	"billiemuk/internal/content"
+
+	"golang.org/x/image/draw"
+)
+
+// posterSuffix replaces a GIF's extension to name its poster frame, e.g.
+// demo.gif -> demo.poster.png.
+const posterSuffix = ".poster.png"
+
+// compressGIF scales every frame of a GIF down to cfg.MaxWidth and, for
+// animations when cfg.GIFPosters is set, writes the first frame as a PNG
+// poster alongside it. GIFs that need no resizing are copied as-is.
+func compressGIF(ctx context.Context, srcPath string, out *output, dstPath string, cfg ImageConfig) (content.Image, error) {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return content.Image{}, fmt.Errorf("open image: %w", err)
+	}
+
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return content.Image{}, fmt.Errorf("decode image %s: %w", srcPath, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return content.Image{}, err
+	}
+
+	width, height := g.Config.Width, g.Config.Height
+	if cfg.MaxWidth > 0 && width > cfg.MaxWidth {
+		newHeight := max(1, height*cfg.MaxWidth/width)
+		for i, frame := range g.Image {
+			g.Image[i] = scaleFrame(frame, width, height, cfg.MaxWidth, newHeight)
+		}
+		width, height = cfg.MaxWidth, newHeight
+		g.Config.Width, g.Config.Height = width, height
+
+		var buf bytes.Buffer
+		if err := gif.EncodeAll(&buf, g); err != nil {
+			return content.Image{}, fmt.Errorf("encode image %s: %w", srcPath, err)
+		}
+		data = buf.Bytes()
+	}
+	if err := out.write(dstPath, mediaRaw, data); err != nil {
+		return content.Image{}, err
+	}
+
+	poster := posterFrame(g)
+	img := describeImage(poster)
+	if !cfg.GIFPosters || len(g.Image) < 2 {
+		return img, nil
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, poster); err != nil {
+		return content.Image{}, fmt.Errorf("encode poster %s: %w", srcPath, err)
+	}
+	posterPath := strings.TrimSuffix(dstPath, path.Ext(dstPath)) + posterSuffix
+	if err := out.write(posterPath, mediaRaw, buf.Bytes()); err != nil {
+		return content.Image{}, err
+	}
+	img.Poster = path.Base(posterPath)
+	return img, nil
+}
+
+// scaleFrame scales a frame positioned on a width x height canvas onto a
+// newWidth x newHeight canvas. Nearest-neighbour sampling keeps every
+// pixel an exact palette entry, including the transparent one, so frames
+// still composite correctly.
+func scaleFrame(frame *image.Paletted, width, height, newWidth, newHeight int) *image.Paletted {
+	r := frame.Rect
+	nr := image.Rect(
+		r.Min.X*newWidth/width, r.Min.Y*newHeight/height,
+		max(r.Min.X*newWidth/width+1, (r.Max.X*newWidth+width-1)/width),
+		max(r.Min.Y*newHeight/height+1, (r.Max.Y*newHeight+height-1)/height),
+	)
+	dst := image.NewPaletted(nr, frame.Palette)
+	for y := nr.Min.Y; y < nr.Max.Y; y++ {
+		sy := min(r.Max.Y-1, r.Min.Y+(y-nr.Min.Y)*r.Dy()/nr.Dy())
+		for x := nr.Min.X; x < nr.Max.X; x++ {
+			sx := min(r.Max.X-1, r.Min.X+(x-nr.Min.X)*r.Dx()/nr.Dx())
+			dst.Pix[dst.PixOffset(x, y)] = frame.Pix[frame.PixOffset(sx, sy)]
+		}
+	}
+	return dst
+}
+
+// posterFrame returns the first frame of g as it appears on screen.
+func posterFrame(g *gif.GIF) image.Image {
+	first := g.Image[0]
+	canvas := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if first.Rect == canvas {
+		return first
+	}
+	poster := image.NewRGBA(canvas)
+	draw.Draw(poster, first.Rect, first, first.Rect.Min, draw.Over)
+	return poster
+}
@@ -0,0 +1,86 @@
+package builder
+
+import (
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"billiemuk/internal/dist"
+)
+
+func writeAnimatedGIF(t *testing.T, path string, width, height, frames int) {
+	t.Helper()
+	palette := color.Palette{color.Transparent, color.Black, color.White}
+	g := &gif.GIF{Config: image.Config{Width: width, Height: height, ColorModel: palette}}
+	for i := 0; i < frames; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, width, height), palette)
+		if i > 0 {
+			// Later frames only update the top half
+			frame = image.NewPaletted(image.Rect(0, 0, width, height/2), palette)
+		}
+		for j := range frame.Pix {
+			frame.Pix[j] = uint8(1 + (i+j)%2)
+		}
+		g.Image = append(g.Image, frame)
+		g.Delay = append(g.Delay, 10)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := gif.EncodeAll(f, g); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCompressGIFScalesEveryFrame(t *testing.T) {
+	root := t.TempDir()
+	imagesDir := filepath.Join(root, "content", "images")
+	distDir := filepath.Join(root, "dist")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeAnimatedGIF(t, filepath.Join(imagesDir, "demo.gif"), 800, 400, 3)
+	writeAnimatedGIF(t, filepath.Join(imagesDir, "still.gif"), 800, 400, 1)
+
+	images, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{MaxWidth: 200, GIFPosters: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(distDir, "images", "demo.gif"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 3 || g.Config.Width != 200 || g.Config.Height != 100 {
+		t.Fatalf("got %d frames at %dx%d, want 3 at 200x100", len(g.Image), g.Config.Width, g.Config.Height)
+	}
+	if r := g.Image[1].Rect; r != image.Rect(0, 0, 200, 50) {
+		t.Errorf("partial frame rect = %v, want (0,0)-(200,50)", r)
+	}
+
+	if w := imageWidth(t, filepath.Join(distDir, "images", "demo.poster.png")); w != 200 {
+		t.Errorf("poster width = %d, want 200", w)
+	}
+	if got := images["images/demo.gif"]; got.Poster != "demo.poster.png" || got.Width != 200 {
+		t.Errorf("demo.gif info = %+v", got)
+	}
+
+	// Single-frame GIFs have nothing to play
+	if _, err := os.Stat(filepath.Join(distDir, "images", "still.poster.png")); !os.IsNotExist(err) {
+		t.Error("poster written for a still GIF")
+	}
+	if got := images["images/still.gif"]; got.Poster != "" {
+		t.Errorf("still.gif info = %+v, want no poster", got)
+	}
+}
@@ -1,91 +1,330 @@
 package builder
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
+	"image/gif"
 	"image/jpeg"
 	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
+	"billiemuk/internal/content"
+
+	"github.com/tdewolff/minify/v2"
 	"golang.org/x/image/draw"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultImageMaxWidth = 1200
+	DefaultJPEGQuality   = 85
 )
 
-const maxImageWidth = 1200
-const jpegQuality = 85
+// rasterFormats maps the extensions of resizable images to their format.
+var rasterFormats = map[string]string{
+	".jpg":  "jpeg",
+	".jpeg": "jpeg",
+	".png":  "png",
+	".gif":  "gif",
+}
+
+// sidecarExt is appended to an image's file name to name its sidecar file
+// of per-image overrides, e.g. diagram.png.yaml.
+const sidecarExt = ".yaml"
+
+// ImageConfig controls how JPEG, PNG and GIF images are resized and
+// re-encoded.
+type ImageConfig struct {
+	// MaxWidth is the width wider images are scaled down to; 0 keeps
+	// images at full size, as in a sidecar.
+	MaxWidth int
+	// JPEGQuality is the JPEG encoding quality, from 1 to 100, or 0 for
+	// DefaultJPEGQuality.
+	JPEGQuality int
+	// GIFPosters writes a PNG of the first frame of each animated GIF,
+	// which posts show until the animation is clicked.
+	GIFPosters bool
+
+	// sanitizeSVG is set from Config.SanitizeSVG.
+	sanitizeSVG bool
+}
+
+func (c ImageConfig) withDefaults() ImageConfig {
+	if c.JPEGQuality == 0 {
+		c.JPEGQuality = DefaultJPEGQuality
+	}
+	return c
+}
+
+// CheckJPEGQuality reports whether q is a usable JPEG quality, as set with
+// --jpeg-quality or in a sidecar.
+func CheckJPEGQuality(q int) error {
+	if q < 1 || q > 100 {
+		return errors.New("quality must be between 1 and 100")
+	}
+	return nil
+}
+
+// imageOverrides are the per-image settings read from a sidecar file.
+// A max_width of 0 keeps the image at full size; original publishes the
+// source file without resizing or re-encoding it.
+type imageOverrides struct {
+	MaxWidth *int  `yaml:"max_width"`
+	Quality  *int  `yaml:"quality"`
+	Poster   *bool `yaml:"poster"`
+	Original bool  `yaml:"original"`
+}
+
+// imageSettings returns cfg with the overrides from the sidecar of the
+// image at path applied, if it has one.
+func imageSettings(path string, cfg ImageConfig) (ImageConfig, bool, error) {
+	data, err := os.ReadFile(path + sidecarExt)
+	if os.IsNotExist(err) {
+		return cfg, false, nil
+	}
+	if err != nil {
+		return cfg, false, err
+	}
+
+	var o imageOverrides
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&o); err != nil && err != io.EOF {
+		return cfg, false, fmt.Errorf("image settings %s: %w", path+sidecarExt, err)
+	}
+	if o.MaxWidth != nil {
+		cfg.MaxWidth = *o.MaxWidth
+	}
+	if o.Quality != nil {
+		if err := CheckJPEGQuality(*o.Quality); err != nil {
+			return cfg, false, fmt.Errorf("image settings %s: %w", path+sidecarExt, err)
+		}
+		cfg.JPEGQuality = *o.Quality
+	}
+	if o.Poster != nil {
+		cfg.GIFPosters = *o.Poster
+	}
+	return cfg, o.Original, nil
+}
 
-func processImages(contentDir, distDir string) error {
+// processImages resizes and re-encodes JPEG, PNG and GIF images and
+// minifies SVGs from content/images into dist/images using up to jobs
+// workers, copying other files as-is. Sidecar files override cfg for
+// single images. The size, dominant colour and placeholder of each image
+// are written to dist/images/.images.json and returned, keyed by path
+// under contentDir.
+func processImages(ctx context.Context, jobs int, contentDir string, out *output, cfg ImageConfig) (map[string]content.Image, error) {
+	cfg = cfg.withDefaults()
 	imagesDir := filepath.Join(contentDir, "images")
 	if _, err := os.Stat(imagesDir); os.IsNotExist(err) {
-		return nil
+		return nil, nil
+	}
+
+	m := newMinifier()
+	var mu sync.Mutex
+	images := make(map[string]content.Image)
+	record := func(path string, img content.Image) {
+		mu.Lock()
+		defer mu.Unlock()
+		images[path] = img
 	}
 
-	return filepath.Walk(imagesDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
+	var tasks []func(context.Context) error
+	err := filepath.Walk(imagesDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasSuffix(path, sidecarExt) {
 			return err
 		}
 
 		rel, _ := filepath.Rel(imagesDir, path)
-		outPath := filepath.Join(distDir, "images", rel)
-
-		ext := strings.ToLower(filepath.Ext(path))
-		switch ext {
-		case ".jpg", ".jpeg":
-			return compressImage(path, outPath, "jpeg")
-		case ".png":
-			return compressImage(path, outPath, "png")
-		default:
-			// Copy non-image files as-is (e.g. SVG, GIF)
-			data, err := os.ReadFile(path)
+		outPath := "images/" + filepath.ToSlash(rel)
+		if outPath == imageManifest {
+			return fmt.Errorf("%s: name is reserved for the image manifest", path)
+		}
+
+		tasks = append(tasks, func(ctx context.Context) error {
+			settings, original, err := imageSettings(path, cfg)
 			if err != nil {
 				return err
 			}
-			return writeFile(outPath, string(data))
-		}
+			ext := strings.ToLower(filepath.Ext(path))
+			var img content.Image
+			switch {
+			case original && rasterFormats[ext] != "":
+				var ok bool
+				img, ok, err = publishOriginal(path, out, outPath, rasterFormats[ext])
+				if err != nil || !ok {
+					return err
+				}
+			case !original && (ext == ".jpg" || ext == ".jpeg"):
+				img, err = compressImage(ctx, path, out, outPath, "jpeg", settings)
+			case !original && ext == ".png":
+				img, err = compressImage(ctx, path, out, outPath, "png", settings)
+			case !original && ext == ".gif":
+				img, err = compressGIF(ctx, path, out, outPath, settings)
+			case ext == ".svg":
+				return compressSVG(path, m, out, outPath, settings, original)
+			default:
+				// Copy other files as-is
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return err
+				}
+				return out.write(outPath, mediaRaw, data)
+			}
+			if err != nil {
+				return err
+			}
+			record(outPath, img)
+			return nil
+		})
+		return nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	if err := runTasks(ctx, jobs, tasks); err != nil {
+		return nil, err
+	}
+
+	manifest, err := encodeImageManifest(images)
+	if err != nil {
+		return nil, fmt.Errorf("encode image manifest: %w", err)
+	}
+	if err := out.write(imageManifest, mediaRaw, manifest); err != nil {
+		return nil, err
+	}
+	return images, nil
 }
 
-func compressImage(srcPath, dstPath, format string) error {
-	f, err := os.Open(srcPath)
+// compressSVG validates, optionally sanitises and, unless original is
+// set, minifies an SVG.
+func compressSVG(srcPath string, m *minify.M, out *output, dstPath string, cfg ImageConfig, original bool) error {
+	data, err := os.ReadFile(srcPath)
 	if err != nil {
 		return fmt.Errorf("open image: %w", err)
 	}
-	defer f.Close()
+	data, err = prepareSVG(data, cfg.sanitizeSVG)
+	if err != nil {
+		return fmt.Errorf("%s: %w", srcPath, err)
+	}
+	if original {
+		return out.write(dstPath, mediaRaw, data)
+	}
+	minified, err := m.Bytes(mediaSVG, data)
+	if err != nil {
+		return fmt.Errorf("minify %s: %w", srcPath, err)
+	}
+	return out.write(dstPath, mediaRaw, minified)
+}
 
-	img, _, err := image.Decode(f)
+// publishOriginal publishes a JPEG, PNG or GIF without re-encoding it, as
+// a sidecar's original: true asks, but still strips JPEG and PNG metadata,
+// keeping only the EXIF orientation. ok is false when the image can't be
+// decoded; it is published unchanged and has no description.
+func publishOriginal(srcPath string, out *output, dstPath, format string) (img content.Image, ok bool, err error) {
+	data, err := os.ReadFile(srcPath)
 	if err != nil {
-		return fmt.Errorf("decode image %s: %w", srcPath, err)
+		return content.Image{}, false, fmt.Errorf("open image: %w", err)
 	}
 
-	bounds := img.Bounds()
-	width := bounds.Dx()
-	height := bounds.Dy()
+	var decoded image.Image
+	if format == "gif" {
+		if g, err := gif.DecodeAll(bytes.NewReader(data)); err == nil {
+			decoded = posterFrame(g)
+		}
+	} else {
+		orientation := exifOrientation(data, format)
+		if stripped, ok := stripMetadata(data, format); ok {
+			if orientation != 1 {
+				stripped = withOrientation(stripped, format, orientation)
+			}
+			data = stripped
+		}
+		if d, _, err := image.Decode(bytes.NewReader(data)); err == nil {
+			decoded = orient(d, orientation)
+		}
+	}
 
-	// Resize if wider than max
-	if width > maxImageWidth {
-		newHeight := int(float64(height) * float64(maxImageWidth) / float64(width))
-		resized := image.NewRGBA(image.Rect(0, 0, maxImageWidth, newHeight))
-		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
-		img = resized
+	if err := out.write(dstPath, mediaRaw, data); err != nil {
+		return content.Image{}, false, err
 	}
+	if decoded == nil {
+		return content.Image{}, false, nil
+	}
+	return describeImage(decoded), true, nil
+}
 
-	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
-		return err
+// compressImage re-encodes an image without its metadata, turned upright
+// according to its EXIF orientation and scaled down to cfg.MaxWidth. When
+// the image needs neither and re-encoding would make it larger, the
+// original is published with its metadata stripped instead.
+func compressImage(ctx context.Context, srcPath string, out *output, dstPath, format string, cfg ImageConfig) (content.Image, error) {
+	data, err := os.ReadFile(srcPath)
+	if err != nil {
+		return content.Image{}, fmt.Errorf("open image: %w", err)
 	}
 
-	out, err := os.Create(dstPath)
+	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		return fmt.Errorf("create output: %w", err)
+		return content.Image{}, fmt.Errorf("decode image %s: %w", srcPath, err)
+	}
+
+	// Decoding is the slow part, so give up here if the build has failed
+	if err := ctx.Err(); err != nil {
+		return content.Image{}, err
+	}
+
+	orientation := exifOrientation(data, format)
+	img = orient(img, orientation)
+
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Resize if wider than max. A max width of 0 keeps the full size.
+	resize := cfg.MaxWidth > 0 && width > cfg.MaxWidth
+	if resize {
+		newHeight := int(float64(height) * float64(cfg.MaxWidth) / float64(width))
+		resized := image.NewRGBA(image.Rect(0, 0, cfg.MaxWidth, newHeight))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Over, nil)
+
+		// Map a resized palette image back onto its palette so the PNG
+		// stays indexed rather than growing into full colour
+		if p, ok := img.(*image.Paletted); ok {
+			paletted := image.NewPaletted(resized.Bounds(), p.Palette)
+			draw.Draw(paletted, paletted.Bounds(), resized, image.Point{}, draw.Src)
+			img = paletted
+		} else {
+			img = resized
+		}
 	}
-	defer out.Close()
 
+	var buf bytes.Buffer
 	switch format {
 	case "jpeg":
-		return jpeg.Encode(out, img, &jpeg.Options{Quality: jpegQuality})
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: cfg.JPEGQuality})
 	case "png":
-		return png.Encode(out, img)
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		err = enc.Encode(&buf, img)
 	default:
-		return fmt.Errorf("unsupported format: %s", format)
+		err = fmt.Errorf("unsupported format: %s", format)
+	}
+	if err != nil {
+		return content.Image{}, fmt.Errorf("encode image %s: %w", srcPath, err)
+	}
+
+	encoded := buf.Bytes()
+	if !resize && orientation == 1 {
+		if stripped, ok := stripMetadata(data, format); ok && len(stripped) <= len(encoded) {
+			encoded = stripped
+		}
 	}
+	return describeImage(img), out.write(dstPath, mediaRaw, encoded)
 }
@@ -1,12 +1,16 @@
 package builder
 
 import (
+	"context"
 	"image"
+	"image/color"
 	"image/jpeg"
 	"image/png"
 	"os"
 	"path/filepath"
 	"testing"
+
+	"billiemuk/internal/dist"
 )
 
 func TestProcessImagesResizesLargeJPEG(t *testing.T) {
@@ -29,7 +33,7 @@ func TestProcessImagesResizesLargeJPEG(t *testing.T) {
 	}
 	f.Close()
 
-	if err := processImages(filepath.Join(root, "content"), distDir); err != nil {
+	if _, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{MaxWidth: DefaultImageMaxWidth}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -45,8 +49,16 @@ func TestProcessImagesResizesLargeJPEG(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	if outImg.Width > maxImageWidth {
-		t.Errorf("output width = %d, want <= %d", outImg.Width, maxImageWidth)
+	if outImg.Width > DefaultImageMaxWidth {
+		t.Errorf("output width = %d, want <= %d", outImg.Width, DefaultImageMaxWidth)
+	}
+
+	// A MaxWidth of 0 keeps full size, as max_width: 0 does in a sidecar
+	if _, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := imageWidth(t, outPath); got != 2400 {
+		t.Errorf("output width with MaxWidth 0 = %d, want 2400", got)
 	}
 }
 
@@ -70,7 +82,7 @@ func TestProcessImagesKeepsSmallPNG(t *testing.T) {
 	}
 	f.Close()
 
-	if err := processImages(filepath.Join(root, "content"), distDir); err != nil {
+	if _, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{}); err != nil {
 		t.Fatal(err)
 	}
 
@@ -89,3 +101,123 @@ func TestProcessImagesKeepsSmallPNG(t *testing.T) {
 		t.Errorf("output width = %d, want 400 (should not resize)", outImg.Width)
 	}
 }
+
+func TestProcessImagesSidecarOverrides(t *testing.T) {
+	root := t.TempDir()
+	imagesDir := filepath.Join(root, "content", "images")
+	distDir := filepath.Join(root, "dist")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	writePNG(t, filepath.Join(imagesDir, "diagram.png"), image.NewRGBA(image.Rect(0, 0, 800, 100)))
+	writePNG(t, filepath.Join(imagesDir, "photo.png"), image.NewRGBA(image.Rect(0, 0, 800, 100)))
+	if err := os.WriteFile(filepath.Join(imagesDir, "diagram.png.yaml"), []byte("max_width: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	raw := []byte("not really a png")
+	if err := os.WriteFile(filepath.Join(imagesDir, "raw.png"), raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(imagesDir, "raw.png.yaml"), []byte("original: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := ImageConfig{MaxWidth: 400}
+	if _, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := imageWidth(t, filepath.Join(distDir, "images", "diagram.png")); w != 800 {
+		t.Errorf("diagram width = %d, want 800 (sidecar keeps full size)", w)
+	}
+	if w := imageWidth(t, filepath.Join(distDir, "images", "photo.png")); w != 400 {
+		t.Errorf("photo width = %d, want 400", w)
+	}
+	if got := readFile(t, filepath.Join(distDir, "images", "raw.png")); got != string(raw) {
+		t.Errorf("original image was re-encoded: %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(distDir, "images", "diagram.png.yaml")); !os.IsNotExist(err) {
+		t.Error("sidecar file was published")
+	}
+}
+
+func TestProcessImagesRejectsUnknownSidecarKeys(t *testing.T) {
+	root := t.TempDir()
+	imagesDir := filepath.Join(root, "content", "images")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePNG(t, filepath.Join(imagesDir, "a.png"), image.NewRGBA(image.Rect(0, 0, 10, 10)))
+	if err := os.WriteFile(filepath.Join(imagesDir, "a.png.yaml"), []byte("max_widht: 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(filepath.Join(root, "dist")), false), ImageConfig{})
+	if err == nil {
+		t.Fatal("expected an error for a misspelled sidecar key")
+	}
+}
+
+func TestProcessImagesKeepsPNGPalette(t *testing.T) {
+	root := t.TempDir()
+	imagesDir := filepath.Join(root, "content", "images")
+	distDir := filepath.Join(root, "dist")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	palette := color.Palette{color.White, color.Black, color.RGBA{0xff, 0, 0, 0xff}}
+	img := image.NewPaletted(image.Rect(0, 0, 1000, 500), palette)
+	for x := 0; x < 1000; x++ {
+		img.SetColorIndex(x, x%500, uint8(x%3))
+	}
+	writePNG(t, filepath.Join(imagesDir, "screenshot.png"), img)
+
+	if _, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{MaxWidth: 500}); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(distDir, "images", "screenshot.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	out, err := png.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, ok := out.(*image.Paletted)
+	if !ok {
+		t.Fatalf("output is %T, want *image.Paletted", out)
+	}
+	if p.Bounds().Dx() != 500 || len(p.Palette) != len(palette) {
+		t.Errorf("output is %dpx wide with %d colours, want 500px and %d", p.Bounds().Dx(), len(p.Palette), len(palette))
+	}
+}
+
+func writePNG(t *testing.T, path string, img image.Image) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func imageWidth(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg.Width
+}
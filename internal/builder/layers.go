@@ -0,0 +1,43 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// layeredFiles walks each directory in order and returns the files found,
+// keyed by slash-separated path relative to their directory, along with the
+// sorted keys. A file in a later directory replaces the file with the same
+// relative path in an earlier one. Dotfiles are ignored and missing
+// directories are skipped.
+func layeredFiles(dirs ...string) (map[string]string, []string, error) {
+	files := make(map[string]string)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+				return err
+			}
+			rel, _ := filepath.Rel(dir, path)
+			files[filepath.ToSlash(rel)] = path
+			return nil
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return files, names, nil
+}
@@ -0,0 +1,76 @@
+package builder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"billiemuk/internal/dist"
+)
+
+func TestLayeredFilesSiteOverridesTheme(t *testing.T) {
+	root := t.TempDir()
+	theme := filepath.Join(root, "theme")
+	site := filepath.Join(root, "site")
+
+	files := map[string]string{
+		filepath.Join(theme, "css", "theme.css"): "theme",
+		filepath.Join(theme, "js", "app.js"):     "theme",
+		filepath.Join(site, "css", "theme.css"):  "site",
+	}
+	for path, data := range files {
+		if err := writeFile(path, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, names, err := layeredFiles(theme, site, filepath.Join(root, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(names, ",") != "css/theme.css,js/app.js" {
+		t.Errorf("names = %v", names)
+	}
+	if got["css/theme.css"] != filepath.Join(site, "css", "theme.css") {
+		t.Errorf("css/theme.css = %s, want site copy", got["css/theme.css"])
+	}
+	if got["js/app.js"] != filepath.Join(theme, "js", "app.js") {
+		t.Errorf("js/app.js = %s, want theme copy", got["js/app.js"])
+	}
+}
+
+func TestProcessStaticLayersTheme(t *testing.T) {
+	root := t.TempDir()
+	theme := filepath.Join(root, "theme")
+	site := filepath.Join(root, "site")
+	distDir := filepath.Join(root, "dist")
+
+	if err := writeFile(filepath.Join(theme, "fonts", "a.woff2"), "theme font"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(theme, "robots.txt"), "theme"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(filepath.Join(site, "robots.txt"), "site"); err != nil {
+		t.Fatal(err)
+	}
+
+	assets, _, err := processStatic(context.Background(), 0, []string{theme, site}, newOutput(dist.Dir(distDir), false), AssetConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(distDir, "static", assets["robots.txt"].Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "site" {
+		t.Errorf("robots.txt = %q, want site override", data)
+	}
+	if _, err := os.Stat(filepath.Join(distDir, "static", assets["fonts/a.woff2"].Path)); err != nil {
+		t.Error("theme-only file not copied")
+	}
+}
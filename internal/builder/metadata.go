@@ -0,0 +1,268 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// JPEG markers of segments that carry metadata rather than image data:
+// APP1 holds EXIF (including GPS) and XMP, APP13 holds IPTC.
+const (
+	jpegAPP1  = 0xE1
+	jpegAPP13 = 0xED
+	jpegSOS   = 0xDA
+	jpegEOI   = 0xD9
+)
+
+// PNG chunks that carry metadata: EXIF, text comments and timestamps.
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true, "tEXt": true, "zTXt": true, "iTXt": true, "tIME": true,
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// jpegSegments calls fn with the marker and bytes of each segment before
+// the image data, returning the offset of the start-of-scan segment.
+// ok is false for malformed files.
+func jpegSegments(data []byte, fn func(marker byte, seg []byte)) (sos int, ok bool) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 0, false
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return 0, false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Fill byte
+			i++
+			continue
+		case marker == jpegSOS || marker == jpegEOI:
+			return i, true
+		case marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7):
+			// Standalone markers have no length
+			fn(marker, data[i:i+2])
+			i += 2
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + n
+		if n < 2 || end > len(data) {
+			return 0, false
+		}
+		fn(marker, data[i:end])
+		i = end
+	}
+	return 0, false
+}
+
+// pngChunks calls fn with the type and bytes of each chunk up to and
+// including IEND. ok is false for malformed files.
+func pngChunks(data []byte, fn func(typ string, chunk []byte)) bool {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return false
+	}
+	i := len(pngSignature)
+	for i+12 <= len(data) {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + n
+		if n < 0 || end > len(data) {
+			return false
+		}
+		typ := string(data[i+4 : i+8])
+		fn(typ, data[i:end])
+		if typ == "IEND" {
+			return true
+		}
+		i = end
+	}
+	return false
+}
+
+// stripMetadata returns an encoded JPEG or PNG without its EXIF, XMP,
+// IPTC and text metadata. Colour profiles are kept. ok is false when the
+// file could not be parsed.
+func stripMetadata(data []byte, format string) ([]byte, bool) {
+	out := make([]byte, 0, len(data))
+	switch format {
+	case "jpeg":
+		out = append(out, data[:2]...)
+		sos, ok := jpegSegments(data, func(marker byte, seg []byte) {
+			if marker != jpegAPP1 && marker != jpegAPP13 {
+				out = append(out, seg...)
+			}
+		})
+		if !ok {
+			return nil, false
+		}
+		return append(out, data[sos:]...), true
+	case "png":
+		out = append(out, pngSignature...)
+		ok := pngChunks(data, func(typ string, chunk []byte) {
+			if !pngMetadataChunks[typ] {
+				out = append(out, chunk...)
+			}
+		})
+		return out, ok
+	}
+	return nil, false
+}
+
+// withOrientation adds a minimal EXIF block holding only orientation o to
+// a JPEG or PNG stripped of its metadata, so an image published without
+// rotating it still displays upright.
+func withOrientation(data []byte, format string, o int) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{uint16(o), 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+
+	var block []byte
+	var at int
+	switch format {
+	case "jpeg":
+		// An APP1 segment straight after the start-of-image marker
+		payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+		block = binary.BigEndian.AppendUint16([]byte{0xFF, jpegAPP1}, uint16(len(payload)+2))
+		block = append(block, payload...)
+		at = 2
+	case "png":
+		// An eXIf chunk after IHDR, which always has 13 bytes of data
+		block = binary.BigEndian.AppendUint32(nil, uint32(tiff.Len()))
+		block = append(block, "eXIf"...)
+		block = append(block, tiff.Bytes()...)
+		block = binary.BigEndian.AppendUint32(block, crc32.ChecksumIEEE(block[4:]))
+		at = len(pngSignature) + 25
+	default:
+		return data
+	}
+	if len(data) < at {
+		return data
+	}
+	out := make([]byte, 0, len(data)+len(block))
+	out = append(out, data[:at]...)
+	out = append(out, block...)
+	return append(out, data[at:]...)
+}
+
+// exifOrientation returns the EXIF orientation (1-8) of an encoded JPEG or
+// PNG, or 1 when it has none.
+func exifOrientation(data []byte, format string) int {
+	var exif []byte
+	switch format {
+	case "jpeg":
+		jpegSegments(data, func(marker byte, seg []byte) {
+			if marker == jpegAPP1 && exif == nil && bytes.HasPrefix(seg[4:], []byte("Exif\x00\x00")) {
+				exif = seg[10:]
+			}
+		})
+	case "png":
+		pngChunks(data, func(typ string, chunk []byte) {
+			if typ == "eXIf" && exif == nil {
+				exif = chunk[8 : len(chunk)-4]
+			}
+		})
+	}
+	return tiffOrientation(exif)
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of EXIF
+// data in TIFF format.
+func tiffOrientation(b []byte) int {
+	if len(b) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(b[4:]))
+	if ifd < 8 || ifd+2 > len(b) {
+		return 1
+	}
+	entries := int(order.Uint16(b[ifd:]))
+	for i := 0; i < entries; i++ {
+		e := ifd + 2 + 12*i
+		if e+12 > len(b) {
+			break
+		}
+		// Orientation is tag 0x0112 of type SHORT (3)
+		if order.Uint16(b[e:]) == 0x0112 && order.Uint16(b[e+2:]) == 3 {
+			if v := int(order.Uint16(b[e+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+		}
+	}
+	return 1
+}
+
+// orient rotates and flips img so it displays upright without its EXIF
+// orientation. Palette images stay paletted.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	rect := image.Rect(0, 0, dw, dh)
+
+	var out image.Image
+	var set func(dx, dy, sx, sy int)
+	if src, ok := img.(*image.Paletted); ok {
+		dst := image.NewPaletted(rect, src.Palette)
+		set = func(dx, dy, sx, sy int) {
+			dst.Pix[dst.PixOffset(dx, dy)] = src.Pix[src.PixOffset(b.Min.X+sx, b.Min.Y+sy)]
+		}
+		out = dst
+	} else {
+		src := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+		dst := image.NewRGBA(rect)
+		set = func(dx, dy, sx, sy int) {
+			d, s := dst.PixOffset(dx, dy), src.PixOffset(sx, sy)
+			copy(dst.Pix[d:d+4], src.Pix[s:s+4])
+		}
+		out = dst
+	}
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			switch orientation {
+			case 2: // mirrored
+				set(x, y, w-1-x, y)
+			case 3: // rotated 180°
+				set(x, y, w-1-x, h-1-y)
+			case 4: // mirrored vertically
+				set(x, y, x, h-1-y)
+			case 5: // transposed
+				set(x, y, y, x)
+			case 6: // rotated 90° clockwise
+				set(x, y, y, h-1-x)
+			case 7: // transversed
+				set(x, y, w-1-y, h-1-x)
+			case 8: // rotated 90° anticlockwise
+				set(x, y, w-1-y, x)
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,191 @@
+package builder
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"billiemuk/internal/dist"
+)
+
+// withEXIF inserts an APP1 EXIF segment with the given orientation and a
+// fake GPS payload after the JPEG start-of-image marker.
+func withEXIF(t *testing.T, jpg []byte, orientation uint16) []byte {
+	t.Helper()
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	binary.Write(&tiff, binary.BigEndian, uint32(8))
+	binary.Write(&tiff, binary.BigEndian, uint16(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.BigEndian, uint32(1))
+	binary.Write(&tiff, binary.BigEndian, []uint16{orientation, 0})
+	binary.Write(&tiff, binary.BigEndian, uint32(0))
+	tiff.WriteString("GPS 51.5074N 0.1278W")
+
+	payload := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	seg := []byte{0xFF, jpegAPP1, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(len(payload)+2))
+	seg = append(seg, payload...)
+
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, seg...)
+	return append(out, jpg[2:]...)
+}
+
+func encodeJPEG(t *testing.T, img image.Image, quality int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExifOrientation(t *testing.T) {
+	jpg := encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 8, 8)), 80)
+	if got := exifOrientation(jpg, "jpeg"); got != 1 {
+		t.Errorf("orientation without EXIF = %d, want 1", got)
+	}
+	if got := exifOrientation(withEXIF(t, jpg, 6), "jpeg"); got != 6 {
+		t.Errorf("orientation = %d, want 6", got)
+	}
+}
+
+func TestOrient(t *testing.T) {
+	// A 2x1 image with a red left pixel and blue right pixel
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	red, blue := color.RGBA{0xff, 0, 0, 0xff}, color.RGBA{0, 0, 0xff, 0xff}
+	img.Set(0, 0, red)
+	img.Set(1, 0, blue)
+
+	for _, tt := range []struct {
+		orientation int
+		top, bottom color.RGBA
+	}{
+		{6, red, blue}, // clockwise: left edge becomes the top
+		{8, blue, red}, // anticlockwise: right edge becomes the top
+	} {
+		got := orient(img, tt.orientation)
+		if b := got.Bounds(); b.Dx() != 1 || b.Dy() != 2 {
+			t.Fatalf("orientation %d: size %dx%d, want 1x2", tt.orientation, b.Dx(), b.Dy())
+		}
+		if got.At(0, 0) != tt.top || got.At(0, 1) != tt.bottom {
+			t.Errorf("orientation %d: got %v over %v", tt.orientation, got.At(0, 0), got.At(0, 1))
+		}
+	}
+}
+
+func TestStripPNGMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	// Insert a tEXt chunk after IHDR
+	text := []byte("Comment\x00taken at home")
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)))
+	chunk = append(chunk, "tEXt"...)
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+	ihdrEnd := len(pngSignature) + 25
+	withText := append(append(append([]byte{}, data[:ihdrEnd]...), chunk...), data[ihdrEnd:]...)
+
+	stripped, ok := stripMetadata(withText, "png")
+	if !ok {
+		t.Fatal("stripMetadata failed to parse PNG")
+	}
+	if !bytes.Equal(stripped, data) {
+		t.Error("tEXt chunk not stripped")
+	}
+}
+
+func TestCompressImageStripsEXIFAndRotates(t *testing.T) {
+	root := t.TempDir()
+	imagesDir := filepath.Join(root, "content", "images")
+	distDir := filepath.Join(root, "dist")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	photo := withEXIF(t, encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 40, 20)), 90), 6)
+	if err := os.WriteFile(filepath.Join(imagesDir, "photo.jpg"), photo, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Already heavily compressed, so re-encoding at the default quality
+	// would only make it larger
+	small := withEXIF(t, encodeJPEG(t, image.NewGray(image.Rect(0, 0, 64, 64)), 30), 1)
+	if err := os.WriteFile(filepath.Join(imagesDir, "small.jpg"), small, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{JPEGQuality: 100}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"photo.jpg", "small.jpg"} {
+		data, err := os.ReadFile(filepath.Join(distDir, "images", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("Exif")) || bytes.Contains(data, []byte("GPS")) {
+			t.Errorf("%s: EXIF metadata not stripped", name)
+		}
+	}
+
+	if w := imageWidth(t, filepath.Join(distDir, "images", "photo.jpg")); w != 20 {
+		t.Errorf("photo width = %d, want 20 (rotated upright)", w)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(distDir, "images", "small.jpg"))
+	if want, _ := stripMetadata(small, "jpeg"); !bytes.Equal(data, want) {
+		t.Errorf("small.jpg is %d bytes, want the stripped original (%d bytes)", len(data), len(want))
+	}
+}
+
+func TestOriginalImagesAreStrippedAndDescribed(t *testing.T) {
+	root := t.TempDir()
+	imagesDir := filepath.Join(root, "content", "images")
+	distDir := filepath.Join(root, "dist")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	jpg := encodeJPEG(t, image.NewRGBA(image.Rect(0, 0, 2000, 20)), 90)
+	if err := os.WriteFile(filepath.Join(imagesDir, "wide.jpg"), withEXIF(t, jpg, 6), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(imagesDir, "wide.jpg.yaml"), []byte("original: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	images, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{MaxWidth: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(distDir, "images", "wide.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("GPS")) {
+		t.Error("metadata not stripped from original image")
+	}
+	if !bytes.Equal(data[len(data)-len(jpg)+2:], jpg[2:]) {
+		t.Error("original image was re-encoded")
+	}
+	if got := exifOrientation(data, "jpeg"); got != 6 {
+		t.Errorf("orientation = %d, want 6 kept so it displays upright", got)
+	}
+	if img := images["images/wide.jpg"]; img.Width != 20 || img.Height != 2000 {
+		t.Errorf("manifest entry = %+v, want 20x2000", img)
+	}
+}
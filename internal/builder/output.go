@@ -0,0 +1,140 @@
+package builder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+
+	"billiemuk/internal/dist"
+
+	"github.com/andybalholm/brotli"
+	"github.com/tdewolff/minify/v2"
+)
+
+// Media types of generated files, used to pick a minifier.
+const (
+	mediaHTML = "text/html"
+	mediaXML  = "application/xml"
+	mediaJSON = "application/json"
+	mediaRaw  = ""
+)
+
+// DefaultPrecompressMinSize is the smallest file that gets precompressed
+// siblings; below it compression saves too little to be worth a request
+// for the host to negotiate.
+const DefaultPrecompressMinSize = 1024
+
+// precompressExts lists the text formats that benefit from compression.
+var precompressExts = map[string]bool{
+	".html": true,
+	".css":  true,
+	".js":   true,
+	".json": true,
+	".xml":  true,
+	".svg":  true,
+}
+
+// output writes generated files to a dist.Writer. When minify is
+// set, files are minified by media type on the way out; files whose media
+// type has no minifier are written unchanged. When precompress is set,
+// text files of at least precompressMin bytes also get .gz and .br
+// siblings.
+type output struct {
+	dst    dist.Writer
+	minify *minify.M
+
+	precompress    bool
+	precompressMin int
+
+	mu    sync.Mutex
+	files []OutputFile
+}
+
+func newOutput(dst dist.Writer, minifyOutput bool) *output {
+	o := &output{dst: dst}
+	if minifyOutput {
+		o.minify = newMinifier()
+	}
+	return o
+}
+
+// write stores data at rel, a slash-separated path inside the dist
+// directory.
+func (o *output) write(rel, mediatype string, data []byte) error {
+	if o.minify != nil && mediatype != mediaRaw {
+		minified, err := o.minify.Bytes(mediatype, data)
+		switch {
+		case err == nil:
+			data = minified
+		case !errors.Is(err, minify.ErrNotExist):
+			return fmt.Errorf("minify %s: %w", rel, err)
+		}
+	}
+	if err := o.writeFile(rel, data); err != nil {
+		return err
+	}
+
+	if !o.precompress || len(data) < o.precompressMin || !precompressExts[path.Ext(rel)] {
+		return nil
+	}
+	gz, err := gzipBytes(data)
+	if err != nil {
+		return fmt.Errorf("gzip %s: %w", rel, err)
+	}
+	if err := o.writeFile(rel+".gz", gz); err != nil {
+		return err
+	}
+	br, err := brotliBytes(data)
+	if err != nil {
+		return fmt.Errorf("brotli %s: %w", rel, err)
+	}
+	return o.writeFile(rel+".br", br)
+}
+
+// writeFile writes data out and records it for the build report.
+func (o *output) writeFile(rel string, data []byte) error {
+	if err := o.dst.WriteFile(rel, data); err != nil {
+		return err
+	}
+	o.mu.Lock()
+	o.files = append(o.files, OutputFile{Path: rel, Bytes: len(data)})
+	o.mu.Unlock()
+	return nil
+}
+
+// written returns every file written so far.
+func (o *output) written() []OutputFile {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]OutputFile(nil), o.files...)
+}
+
+func gzipBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func brotliBytes(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,122 @@
+package builder
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"billiemuk/internal/dist"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestOutputMinifiesByMediaType(t *testing.T) {
+	dir := t.TempDir()
+	out := newOutput(dist.Dir(dir), true)
+
+	page := "<!DOCTYPE html>\n<html>\n  <body>\n    <p class=\"lead\">  Hello   world  </p>\n  </body>\n</html>\n"
+	if err := out.write("posts/hello/index.html", mediaHTML, []byte(page)); err != nil {
+		t.Fatal(err)
+	}
+	feed := "<rss>\n  <channel>\n    <title>Test</title>\n  </channel>\n</rss>\n"
+	if err := out.write("feed.xml", mediaXML, []byte(feed)); err != nil {
+		t.Fatal(err)
+	}
+	robots := "User-agent: *\nAllow: /\n"
+	if err := out.write("robots.txt", mediaRaw, []byte(robots)); err != nil {
+		t.Fatal(err)
+	}
+
+	html := readFile(t, filepath.Join(dir, "posts", "hello", "index.html"))
+	if strings.Contains(html, "\n  ") {
+		t.Errorf("HTML not minified: %q", html)
+	}
+	if !strings.Contains(html, `class="lead"`) {
+		t.Errorf("HTML minifier dropped attribute quotes: %q", html)
+	}
+	if xml := readFile(t, filepath.Join(dir, "feed.xml")); strings.Contains(xml, "\n") {
+		t.Errorf("XML not minified: %q", xml)
+	}
+	if got := readFile(t, filepath.Join(dir, "robots.txt")); got != robots {
+		t.Errorf("robots.txt = %q, want unchanged", got)
+	}
+}
+
+func TestOutputWithoutMinify(t *testing.T) {
+	dir := t.TempDir()
+	out := newOutput(dist.Dir(dir), false)
+
+	page := "<html>\n  <body></body>\n</html>\n"
+	if err := out.write("index.html", mediaHTML, []byte(page)); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, filepath.Join(dir, "index.html")); got != page {
+		t.Errorf("index.html = %q, want unchanged", got)
+	}
+}
+
+func TestOutputPrecompress(t *testing.T) {
+	dir := t.TempDir()
+	out := newOutput(dist.Dir(dir), false)
+	out.precompress = true
+	out.precompressMin = 100
+
+	large := strings.Repeat("<p>hello</p>", 50)
+	if err := out.write("index.html", mediaHTML, []byte(large)); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.write("small.html", mediaHTML, []byte("<p>hi</p>")); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.write("images/photo.jpg", mediaRaw, []byte(large)); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(filepath.Join(dir, "index.html.gz"))
+	if err != nil {
+		t.Fatal("index.html.gz not created")
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != large {
+		t.Error("index.html.gz does not decompress to the original")
+	}
+
+	br, err := os.ReadFile(filepath.Join(dir, "index.html.br"))
+	if err != nil {
+		t.Fatal("index.html.br not created")
+	}
+	data, err = io.ReadAll(brotli.NewReader(bytes.NewReader(br)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != large {
+		t.Error("index.html.br does not decompress to the original")
+	}
+
+	for _, name := range []string{"small.html.gz", "small.html.br", "images/photo.jpg.gz"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			t.Errorf("%s should not be created", name)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
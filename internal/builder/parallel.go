@@ -0,0 +1,65 @@
+package builder
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// jobCount returns the number of workers to use for n tasks: jobs, or one
+// per CPU when jobs is zero or negative, but never more than n.
+func jobCount(jobs, n int) int {
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	return max(min(jobs, n), 1)
+}
+
+// runTasks runs each task on a pool of up to jobs goroutines and returns
+// the first error. After an error the context passed to running tasks is
+// cancelled and tasks that have not started are skipped. Tasks must write
+// their results into pre-sized, index-addressed storage so the output does
+// not depend on scheduling.
+func runTasks(ctx context.Context, jobs int, tasks []func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+	)
+	next := make(chan func(context.Context) error)
+
+	for range jobCount(jobs, len(tasks)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range next {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := task(ctx); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+	for _, task := range tasks {
+		if ctx.Err() != nil {
+			break
+		}
+		next <- task
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,79 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestRunTasksRunsEverything(t *testing.T) {
+	results := make([]int, 100)
+	var tasks []func(context.Context) error
+	for i := range results {
+		tasks = append(tasks, func(context.Context) error {
+			results[i] = i * i
+			return nil
+		})
+	}
+
+	if err := runTasks(context.Background(), 4, tasks); err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range results {
+		if r != i*i {
+			t.Fatalf("results[%d] = %d, want %d", i, r, i*i)
+		}
+	}
+}
+
+func TestRunTasksStopsAtFirstError(t *testing.T) {
+	boom := errors.New("boom")
+	var ran atomic.Int32
+	var tasks []func(context.Context) error
+	for i := range 1000 {
+		tasks = append(tasks, func(ctx context.Context) error {
+			ran.Add(1)
+			if i == 0 {
+				return boom
+			}
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}
+
+	if err := runTasks(context.Background(), 2, tasks); !errors.Is(err, boom) {
+		t.Fatalf("err = %v, want boom", err)
+	}
+	if n := ran.Load(); n == 1000 {
+		t.Error("tasks kept starting after the first error")
+	}
+}
+
+func TestRunTasksHonoursParentContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	called := false
+	err := runTasks(ctx, 1, []func(context.Context) error{
+		func(context.Context) error { called = true; return nil },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if called {
+		t.Error("task ran with a cancelled context")
+	}
+}
+
+func TestJobCount(t *testing.T) {
+	if got := jobCount(8, 3); got != 3 {
+		t.Errorf("jobCount(8, 3) = %d, want 3", got)
+	}
+	if got := jobCount(2, 10); got != 2 {
+		t.Errorf("jobCount(2, 10) = %d, want 2", got)
+	}
+	if got := jobCount(0, 0); got != 1 {
+		t.Errorf("jobCount(0, 0) = %d, want 1", got)
+	}
+}
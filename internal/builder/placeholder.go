@@ -0,0 +1,97 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"strings"
+
+	"billiemuk/internal/content"
+
+	"golang.org/x/image/draw"
+)
+
+// placeholderSize is the longest side of the blurred thumbnail inlined
+// while an image loads.
+const placeholderSize = 16
+
+// imageManifest lists the size, dominant colour and placeholder of every
+// processed image. processImages rejects a source file with the same
+// name.
+const imageManifest = "images/.images.json"
+
+// isImageOutput reports whether a dist path is a published image.
+func isImageOutput(p string) bool {
+	return strings.HasPrefix(p, "images/") && p != imageManifest
+}
+
+// describeImage returns the size, dominant colour and, for opaque images,
+// a tiny inline thumbnail of img. Placeholders are left out for images
+// with transparency, which would show them through.
+func describeImage(img image.Image) content.Image {
+	b := img.Bounds()
+	info := content.Image{Width: b.Dx(), Height: b.Dy()}
+	if info.Width == 0 || info.Height == 0 {
+		return info
+	}
+
+	tw, th := placeholderSize, max(1, info.Height*placeholderSize/info.Width)
+	if info.Height > info.Width {
+		tw, th = max(1, info.Width*placeholderSize/info.Height), placeholderSize
+	}
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	draw.ApproxBiLinear.Scale(thumb, thumb.Bounds(), img, b, draw.Src, nil)
+	info.Color = dominantColor(thumb)
+
+	if o, ok := img.(interface{ Opaque() bool }); ok && o.Opaque() {
+		var buf bytes.Buffer
+		enc := png.Encoder{CompressionLevel: png.BestCompression}
+		if err := enc.Encode(&buf, thumb); err == nil {
+			info.Placeholder = "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+		}
+	}
+	return info
+}
+
+// dominantColor returns the average colour of the most common group of
+// similar colours in img as a CSS hex colour, ignoring mostly transparent
+// pixels.
+func dominantColor(img *image.RGBA) string {
+	type bucket struct{ r, g, b, n int }
+	buckets := make(map[int]*bucket)
+	best := -1
+	for i := 0; i+3 < len(img.Pix); i += 4 {
+		a := int(img.Pix[i+3])
+		if a < 128 {
+			continue
+		}
+		// Pixels are alpha-premultiplied
+		r, g, b := int(img.Pix[i])*255/a, int(img.Pix[i+1])*255/a, int(img.Pix[i+2])*255/a
+		key := r>>4<<8 | g>>4<<4 | b>>4
+		bk := buckets[key]
+		if bk == nil {
+			bk = &bucket{}
+			buckets[key] = bk
+		}
+		bk.r, bk.g, bk.b, bk.n = bk.r+r, bk.g+g, bk.b+b, bk.n+1
+		if best < 0 || bk.n > buckets[best].n {
+			best = key
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	bk := buckets[best]
+	return fmt.Sprintf("#%02x%02x%02x", bk.r/bk.n, bk.g/bk.n, bk.b/bk.n)
+}
+
+func encodeImageManifest(images map[string]content.Image) ([]byte, error) {
+	b, err := json.MarshalIndent(images, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
@@ -0,0 +1,79 @@
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"billiemuk/internal/content"
+	"billiemuk/internal/dist"
+)
+
+func TestDescribeImage(t *testing.T) {
+	// Mostly blue with a red stripe
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			c := color.RGBA{0x20, 0x40, 0xc0, 0xff}
+			if x < 50 {
+				c = color.RGBA{0xff, 0, 0, 0xff}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	info := describeImage(img)
+	if info.Width != 400 || info.Height != 200 {
+		t.Errorf("size = %dx%d, want 400x200", info.Width, info.Height)
+	}
+	if info.Color != "#2040c0" {
+		t.Errorf("Color = %q, want #2040c0", info.Color)
+	}
+	if !strings.HasPrefix(info.Placeholder, "data:image/png;base64,") || len(info.Placeholder) > 1000 {
+		t.Errorf("Placeholder = %q", info.Placeholder)
+	}
+
+	// Placeholders would show through transparent images
+	if got := describeImage(image.NewNRGBA(image.Rect(0, 0, 10, 10))); got.Placeholder != "" {
+		t.Errorf("transparent image has a placeholder: %q", got.Placeholder)
+	}
+}
+
+func TestProcessImagesWritesManifest(t *testing.T) {
+	root := t.TempDir()
+	imagesDir := filepath.Join(root, "content", "images")
+	distDir := filepath.Join(root, "dist")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writePNG(t, filepath.Join(imagesDir, "a.png"), image.NewGray(image.Rect(0, 0, 30, 20)))
+
+	images, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var manifest map[string]content.Image
+	if err := json.Unmarshal([]byte(readFile(t, filepath.Join(distDir, "images", ".images.json"))), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	got := manifest["images/a.png"]
+	if got.Width != 30 || got.Color != "#000000" || got.Placeholder == "" {
+		t.Errorf("manifest entry = %+v", got)
+	}
+	if images["images/a.png"] != got {
+		t.Errorf("returned %+v, manifest has %+v", images["images/a.png"], got)
+	}
+
+	if err := writeFile(filepath.Join(imagesDir, ".images.json"), "{}"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{}); err == nil {
+		t.Error("processImages() accepted an image named like the manifest")
+	}
+}
@@ -0,0 +1,127 @@
+package builder
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"billiemuk/internal/content"
+)
+
+const maxRelated = 3
+
+// Shared tags are a much stronger signal than overlapping vocabulary, so
+// each one outweighs any possible term similarity score (which is at most 1).
+const tagWeight = 2.0
+
+// minTermScore filters out posts that only share common words.
+const minTermScore = 0.1
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+var stopWords = map[string]bool{
+	"about": true, "after": true, "again": true, "also": true, "because": true,
+	"been": true, "before": true, "being": true, "could": true, "does": true,
+	"each": true, "from": true, "have": true, "here": true, "into": true,
+	"just": true, "like": true, "more": true, "most": true, "much": true,
+	"only": true, "other": true, "over": true, "same": true, "some": true,
+	"such": true, "than": true, "that": true, "their": true, "them": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true,
+	"those": true, "through": true, "very": true, "want": true, "were": true,
+	"what": true, "when": true, "where": true, "which": true, "while": true,
+	"will": true, "with": true, "would": true, "your": true,
+}
+
+// relatedPosts returns, for each post, the indices of up to maxRelated other
+// posts ranked by shared tags and then by term overlap of their bodies.
+func relatedPosts(posts []content.Post) [][]int {
+	vectors := make([]map[string]float64, len(posts))
+	for i, p := range posts {
+		vectors[i] = termVector(p.HTML)
+	}
+
+	related := make([][]int, len(posts))
+	for i := range posts {
+		type candidate struct {
+			index int
+			score float64
+		}
+		var candidates []candidate
+		for j := range posts {
+			if i == j {
+				continue
+			}
+			terms := cosine(vectors[i], vectors[j])
+			tags := sharedTags(posts[i].Tags, posts[j].Tags)
+			if tags == 0 && terms < minTermScore {
+				continue
+			}
+			candidates = append(candidates, candidate{j, float64(tags)*tagWeight + terms})
+		}
+
+		// Posts are sorted newest first, so a stable sort prefers newer
+		// posts when scores tie.
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return candidates[a].score > candidates[b].score
+		})
+		for k, c := range candidates {
+			if k == maxRelated {
+				break
+			}
+			related[i] = append(related[i], c.index)
+		}
+	}
+	return related
+}
+
+func sharedTags(a, b []string) int {
+	n := 0
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// termVector builds a normalised term frequency vector from rendered HTML.
+func termVector(html string) map[string]float64 {
+	text := htmlTagRe.ReplaceAllString(html, " ")
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	vec := make(map[string]float64)
+	for _, w := range words {
+		if len(w) < 4 || stopWords[w] {
+			continue
+		}
+		vec[w]++
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+	for w, v := range vec {
+		vec[w] = v / norm
+	}
+	return vec
+}
+
+func cosine(a, b map[string]float64) float64 {
+	if len(b) < len(a) {
+		a, b = b, a
+	}
+	var dot float64
+	for w, v := range a {
+		dot += v * b[w]
+	}
+	return dot
+}
@@ -0,0 +1,44 @@
+package builder
+
+import (
+	"testing"
+
+	"billiemuk/internal/content"
+)
+
+func TestRelatedPostsPrefersSharedTags(t *testing.T) {
+	posts := []content.Post{
+		{Slug: "a", Tags: []string{"go"}, HTML: "<p>Writing a static site generator.</p>"},
+		{Slug: "b", Tags: []string{"cooking"}, HTML: "<p>Writing a static site generator.</p>"},
+		{Slug: "c", Tags: []string{"go"}, HTML: "<p>Goroutines and channels.</p>"},
+		{Slug: "d", HTML: "<p>Sourdough starters.</p>"},
+	}
+
+	related := relatedPosts(posts)
+
+	if len(related[0]) != 2 {
+		t.Fatalf("related[a] = %v, want 2 entries", related[0])
+	}
+	if related[0][0] != 2 {
+		t.Errorf("most related to a = %s, want c (shared tag)", posts[related[0][0]].Slug)
+	}
+	if related[0][1] != 1 {
+		t.Errorf("second related to a = %s, want b (shared terms)", posts[related[0][1]].Slug)
+	}
+	if len(related[3]) != 0 {
+		t.Errorf("related[d] = %v, want none", related[3])
+	}
+}
+
+func TestRelatedPostsLimit(t *testing.T) {
+	var posts []content.Post
+	for range maxRelated + 2 {
+		posts = append(posts, content.Post{Tags: []string{"go"}})
+	}
+
+	for i, r := range relatedPosts(posts) {
+		if len(r) != maxRelated {
+			t.Errorf("related[%d] has %d entries, want %d", i, len(r), maxRelated)
+		}
+	}
+}
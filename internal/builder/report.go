@@ -0,0 +1,155 @@
+package builder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// largestCount is how many of the largest pages and images a report lists.
+const largestCount = 5
+
+// Report summarises what a build published.
+type Report struct {
+	Posts         int   `json:"posts"`
+	DraftsSkipped int   `json:"drafts_skipped"`
+	Pages         int   `json:"pages"`
+	Images        int   `json:"images"`
+	StaticAssets  int   `json:"static_assets"`
+	BytesWritten  int64 `json:"bytes_written"`
+
+	LargestPages  []OutputFile `json:"largest_pages"`
+	LargestImages []OutputFile `json:"largest_images"`
+
+	Phases   []Phase       `json:"phases"`
+	Duration time.Duration `json:"-"`
+	TotalMS  float64       `json:"total_ms"`
+
+	// Files lists every file written, in path order.
+	Files  []OutputFile  `json:"-"`
+	Assets []AssetResult `json:"assets"`
+
+	// Warnings are problems that didn't fail the build, such as compiled
+	// CSS out of date with its SCSS sources.
+	Warnings []string `json:"warnings,omitempty"`
+
+	// BudgetViolations is filled in by CheckBudget.
+	BudgetViolations []BudgetViolation `json:"budget_violations,omitempty"`
+}
+
+// OutputFile is a file written to the dist directory.
+type OutputFile struct {
+	Path  string `json:"path"`
+	Bytes int    `json:"bytes"`
+}
+
+// Phase records how long one stage of the build took.
+type Phase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"-"`
+	MS       float64       `json:"ms"`
+}
+
+// phase records the time since start under name and returns the current
+// time, ready to time the next phase.
+func (r *Report) phase(name string, start time.Time) time.Time {
+	now := time.Now()
+	d := now.Sub(start)
+	r.Phases = append(r.Phases, Phase{Name: name, Duration: d, MS: millis(d)})
+	return now
+}
+
+// finish fills in the totals from the files written.
+func (r *Report) finish(files []OutputFile, start time.Time) {
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	r.Files = files
+
+	var pages, images []OutputFile
+	for _, f := range files {
+		r.BytesWritten += int64(f.Bytes)
+		switch {
+		case path.Ext(f.Path) == ".html":
+			pages = append(pages, f)
+		case isImageOutput(f.Path):
+			images = append(images, f)
+		}
+	}
+	r.Pages = len(pages)
+	r.Images = len(images)
+	r.LargestPages = largest(pages)
+	r.LargestImages = largest(images)
+
+	for _, a := range r.Assets {
+		if a.Action != AssetExcluded {
+			r.StaticAssets++
+		}
+	}
+
+	r.Duration = time.Since(start)
+	r.TotalMS = millis(r.Duration)
+}
+
+func largest(files []OutputFile) []OutputFile {
+	sorted := make([]OutputFile, len(files))
+	copy(sorted, files)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Bytes > sorted[j].Bytes })
+	return sorted[:min(len(sorted), largestCount)]
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// WriteText writes a human-readable summary of the report.
+func (r *Report) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Posts:   %d (%d drafts skipped)\n", r.Posts, r.DraftsSkipped)
+	fmt.Fprintf(&b, "Pages:   %d\n", r.Pages)
+	fmt.Fprintf(&b, "Images:  %d\n", r.Images)
+	fmt.Fprintf(&b, "Assets:  %d\n", r.StaticAssets)
+	fmt.Fprintf(&b, "Written: %s\n", formatBytes(r.BytesWritten))
+
+	for _, group := range []struct {
+		title string
+		files []OutputFile
+	}{{"Largest pages", r.LargestPages}, {"Largest images", r.LargestImages}} {
+		if len(group.files) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "%s:\n", group.title)
+		for _, f := range group.files {
+			fmt.Fprintf(&b, "  %9s  %s\n", formatBytes(int64(f.Bytes)), f.Path)
+		}
+	}
+
+	fmt.Fprintf(&b, "Timings:\n")
+	for _, p := range r.Phases {
+		fmt.Fprintf(&b, "  %-10s %s\n", p.Name, p.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(&b, "  %-10s %s\n", "total", r.Duration.Round(time.Millisecond))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the report as indented JSON.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,114 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportFinish(t *testing.T) {
+	r := &Report{Assets: []AssetResult{
+		{Source: "css/theme.min.css", Action: AssetCopied},
+		{Source: "scss/theme.scss", Action: AssetExcluded},
+	}}
+	var files []OutputFile
+	for i := range 7 {
+		files = append(files, OutputFile{Path: fmt.Sprintf("posts/p%d/index.html", i), Bytes: 100 * (i + 1)})
+	}
+	files = append(files,
+		OutputFile{Path: "index.html.gz", Bytes: 50},
+		OutputFile{Path: "images/a.jpg", Bytes: 3000},
+		OutputFile{Path: "sitemap.xml", Bytes: 10},
+	)
+
+	r.finish(files, time.Now())
+
+	if r.Pages != 7 {
+		t.Errorf("Pages = %d, want 7", r.Pages)
+	}
+	if r.Images != 1 {
+		t.Errorf("Images = %d, want 1", r.Images)
+	}
+	if r.StaticAssets != 1 {
+		t.Errorf("StaticAssets = %d, want 1", r.StaticAssets)
+	}
+	if want := int64(2800 + 50 + 3000 + 10); r.BytesWritten != want {
+		t.Errorf("BytesWritten = %d, want %d", r.BytesWritten, want)
+	}
+	if len(r.LargestPages) != largestCount || r.LargestPages[0].Path != "posts/p6/index.html" {
+		t.Errorf("LargestPages = %v", r.LargestPages)
+	}
+	if r.Files[0].Path != "images/a.jpg" {
+		t.Errorf("Files not sorted by path: %v", r.Files)
+	}
+}
+
+func TestReportOutput(t *testing.T) {
+	r := &Report{Posts: 2, DraftsSkipped: 1}
+	start := r.phase("parse", time.Now())
+	r.finish([]OutputFile{{Path: "index.html", Bytes: 2048}}, start)
+
+	var text bytes.Buffer
+	if err := r.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"Posts:   2 (1 drafts skipped)", "Written: 2.0 KB", "Largest pages:", "index.html", "parse"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("text report missing %q:\n%s", want, text.String())
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := r.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("invalid JSON report: %v", err)
+	}
+	if decoded["drafts_skipped"] != float64(1) || decoded["bytes_written"] != float64(2048) {
+		t.Errorf("JSON report = %s", buf.String())
+	}
+}
+
+func TestBuildReportCountsDrafts(t *testing.T) {
+	root := t.TempDir()
+	postsDir := filepath.Join(root, "content", "posts")
+	templatesDir := filepath.Join(root, "templates")
+	if err := os.MkdirAll(postsDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyTemplates(t, templatesDir)
+
+	for name, draft := range map[string]bool{"2026-01-01-one.md": false, "2026-01-02-two.md": true} {
+		post := fmt.Sprintf("---\ntitle: %q\ndate: 2026-01-01\ndraft: %t\n---\n\nBody.\n", name, draft)
+		if err := os.WriteFile(filepath.Join(postsDir, name), []byte(post), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := Build(Config{
+		ContentDir:   filepath.Join(root, "content"),
+		TemplatesDir: templatesDir,
+		StaticDir:    filepath.Join(root, "static"),
+		DistDir:      filepath.Join(root, "dist"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Posts != 1 || report.DraftsSkipped != 1 {
+		t.Errorf("Posts = %d, DraftsSkipped = %d, want 1 and 1", report.Posts, report.DraftsSkipped)
+	}
+	if report.Pages == 0 || report.BytesWritten == 0 {
+		t.Errorf("report missing totals: %+v", report)
+	}
+	if len(report.Phases) == 0 {
+		t.Error("report has no phase timings")
+	}
+}
@@ -0,0 +1,249 @@
+package builder
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SCSSMode controls how Build treats compiled CSS that may be out of date
+// with its SCSS sources.
+type SCSSMode string
+
+const (
+	SCSSIgnore  SCSSMode = ""
+	SCSSWarn    SCSSMode = "warn"
+	SCSSFail    SCSSMode = "fail"
+	SCSSCompile SCSSMode = "compile"
+)
+
+// scssSumFile records the hashes of the SCSS sources the checked-in CSS was
+// compiled from, relative to the static directory. It is a dotfile so it is
+// never published.
+const scssSumFile = "css/.scss.sum"
+
+// checkSCSS applies mode to the SCSS sources in staticDir, returning the
+// warning to report in warn mode. Compile mode only runs Sass when the CSS
+// is stale, so the dev server, which watches static/, doesn't rebuild
+// forever on its own output.
+func checkSCSS(mode SCSSMode, staticDir string, loadPaths []string) (warning string, err error) {
+	switch mode {
+	case SCSSIgnore:
+		return "", nil
+	case SCSSCompile, SCSSWarn, SCSSFail:
+		stale, err := StaleSCSS(staticDir)
+		if err != nil {
+			return "", err
+		}
+		if len(stale) == 0 {
+			return "", nil
+		}
+		if mode == SCSSCompile {
+			return "", CompileSCSS(staticDir, loadPaths)
+		}
+		msg := fmt.Sprintf("compiled CSS is out of date with static/scss: %s (run `go run . css`)", strings.Join(stale, ", "))
+		if mode == SCSSFail {
+			return "", errors.New(msg)
+		}
+		return msg, nil
+	default:
+		return "", fmt.Errorf("unknown scss mode %q", mode)
+	}
+}
+
+// scssEntries returns the SCSS entry points in staticDir (files in scss/
+// not starting with an underscore) and every SCSS source including
+// partials, both relative to staticDir.
+func scssEntries(staticDir string) (entries, sources []string, err error) {
+	scssDir := filepath.Join(staticDir, "scss")
+	if _, err := os.Stat(scssDir); os.IsNotExist(err) {
+		return nil, nil, nil
+	}
+	err = filepath.Walk(scssDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".scss" {
+			return err
+		}
+		rel, _ := filepath.Rel(staticDir, path)
+		rel = filepath.ToSlash(rel)
+		sources = append(sources, rel)
+		if filepath.Dir(path) == scssDir && !strings.HasPrefix(info.Name(), "_") {
+			entries = append(entries, rel)
+		}
+		return nil
+	})
+	sort.Strings(sources)
+	return entries, sources, err
+}
+
+// scssOutputs returns the compiled CSS files for an entry point, mirroring
+// the npm build:css script: scss/theme.scss -> css/theme.css, css/theme.min.css.
+func scssOutputs(entry string) (expanded, compressed string) {
+	name := strings.TrimSuffix(filepath.Base(entry), ".scss")
+	return "css/" + name + ".css", "css/" + name + ".min.css"
+}
+
+// StaleSCSS reports compiled CSS files in staticDir that are missing or out
+// of date with their SCSS sources. When css/.scss.sum exists the source
+// hashes are compared against it, which is reliable on fresh checkouts;
+// otherwise modification times are compared.
+func StaleSCSS(staticDir string) ([]string, error) {
+	entries, sources, err := scssEntries(staticDir)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	var outputs []string
+	for _, e := range entries {
+		expanded, compressed := scssOutputs(e)
+		outputs = append(outputs, expanded, compressed)
+	}
+
+	recorded, err := readSCSSSums(filepath.Join(staticDir, scssSumFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	hashed := err == nil
+
+	var sourcesChanged bool
+	var newest int64
+	for _, src := range sources {
+		path := filepath.Join(staticDir, filepath.FromSlash(src))
+		if hashed {
+			sum, err := fileSum(path)
+			if err != nil {
+				return nil, err
+			}
+			if recorded[src] != sum {
+				sourcesChanged = true
+			}
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if t := info.ModTime().UnixNano(); t > newest {
+			newest = t
+		}
+	}
+	if hashed && len(recorded) != len(sources) {
+		sourcesChanged = true
+	}
+
+	var stale []string
+	for _, out := range outputs {
+		info, err := os.Stat(filepath.Join(staticDir, filepath.FromSlash(out)))
+		switch {
+		case os.IsNotExist(err):
+			stale = append(stale, out)
+		case err != nil:
+			return nil, err
+		case hashed && sourcesChanged:
+			stale = append(stale, out)
+		case !hashed && info.ModTime().UnixNano() < newest:
+			stale = append(stale, out)
+		}
+	}
+	return stale, nil
+}
+
+// CompileSCSS compiles each SCSS entry point in staticDir to expanded and
+// compressed CSS using the Dart Sass executable, then records the source
+// hashes in css/.scss.sum. Sass is looked up in each load path's .bin
+// directory (e.g. node_modules/.bin) and then on PATH.
+func CompileSCSS(staticDir string, loadPaths []string) error {
+	entries, sources, err := scssEntries(staticDir)
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+
+	sass, err := findSass(loadPaths)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		expanded, compressed := scssOutputs(entry)
+		for _, out := range []struct {
+			path  string
+			style string
+		}{{expanded, "expanded"}, {compressed, "compressed"}} {
+			args := []string{"--no-source-map", "--style=" + out.style}
+			for _, lp := range loadPaths {
+				args = append(args, "--load-path="+lp)
+			}
+			args = append(args,
+				filepath.Join(staticDir, filepath.FromSlash(entry)),
+				filepath.Join(staticDir, filepath.FromSlash(out.path)),
+			)
+			cmd := exec.Command(sass, args...)
+			if output, err := cmd.CombinedOutput(); err != nil {
+				return fmt.Errorf("sass %s: %w\n%s", entry, err, output)
+			}
+		}
+	}
+
+	return writeSCSSSums(staticDir, sources)
+}
+
+func findSass(loadPaths []string) (string, error) {
+	for _, lp := range loadPaths {
+		path := filepath.Join(lp, ".bin", "sass")
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	path, err := exec.LookPath("sass")
+	if err != nil {
+		return "", fmt.Errorf("sass not found: install Dart Sass or run npm install")
+	}
+	return path, nil
+}
+
+func fileSum(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// readSCSSSums parses a sum file in sha256sum format.
+func readSCSSSums(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sums := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok {
+			continue
+		}
+		sums[name] = sum
+	}
+	return sums, scanner.Err()
+}
+
+func writeSCSSSums(staticDir string, sources []string) error {
+	var b strings.Builder
+	for _, src := range sources {
+		sum, err := fileSum(filepath.Join(staticDir, filepath.FromSlash(src)))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&b, "%s  %s\n", sum, src)
+	}
+	return writeFile(filepath.Join(staticDir, filepath.FromSlash(scssSumFile)), b.String())
+}
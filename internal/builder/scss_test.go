@@ -0,0 +1,175 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeSCSSProject(t *testing.T) string {
+	t.Helper()
+	staticDir := t.TempDir()
+	files := map[string]string{
+		"scss/theme.scss":     "@use \"colors\";\nbody { color: red; }\n",
+		"scss/_colors.scss":   "$red: red;\n",
+		"css/theme.css":       "body { color: red; }\n",
+		"css/theme.min.css":   "body{color:red}",
+		"css/unrelated.css":   "p{}",
+		"scss/nested/_x.scss": "",
+	}
+	for name, data := range files {
+		if err := writeFile(filepath.Join(staticDir, name), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Sources were last edited before the CSS was compiled
+	old := time.Now().Add(-2 * time.Hour)
+	for name := range files {
+		if strings.HasSuffix(name, ".scss") {
+			if err := os.Chtimes(filepath.Join(staticDir, name), old, old); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return staticDir
+}
+
+func TestStaleSCSSUsesSumFile(t *testing.T) {
+	staticDir := writeSCSSProject(t)
+
+	_, sources, err := scssEntries(staticDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeSCSSSums(staticDir, sources); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := StaleSCSS(staticDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("stale = %v, want none after recording sums", stale)
+	}
+
+	// Editing a partial invalidates every output
+	if err := writeFile(filepath.Join(staticDir, "scss", "_colors.scss"), "$red: crimson;\n"); err != nil {
+		t.Fatal(err)
+	}
+	stale, err = StaleSCSS(staticDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(stale, ",") != "css/theme.css,css/theme.min.css" {
+		t.Errorf("stale = %v, want both theme outputs", stale)
+	}
+}
+
+func TestStaleSCSSFallsBackToModTime(t *testing.T) {
+	staticDir := writeSCSSProject(t)
+
+	old := time.Now().Add(-3 * time.Hour)
+	for _, name := range []string{"css/theme.css", "css/theme.min.css"} {
+		if err := os.Chtimes(filepath.Join(staticDir, name), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stale, err := StaleSCSS(staticDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 2 {
+		t.Errorf("stale = %v, want both outputs older than sources", stale)
+	}
+}
+
+func TestStaleSCSSMissingOutput(t *testing.T) {
+	staticDir := writeSCSSProject(t)
+	if err := os.Remove(filepath.Join(staticDir, "css", "theme.min.css")); err != nil {
+		t.Fatal(err)
+	}
+
+	stale, err := StaleSCSS(staticDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(stale, ",") != "css/theme.min.css" {
+		t.Errorf("stale = %v, want css/theme.min.css", stale)
+	}
+}
+
+func TestCheckSCSSFailMode(t *testing.T) {
+	staticDir := writeSCSSProject(t)
+	if err := os.Remove(filepath.Join(staticDir, "css", "theme.css")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := checkSCSS(SCSSFail, staticDir, nil); err == nil {
+		t.Error("expected fail mode to return an error for stale CSS")
+	}
+	warning, err := checkSCSS(SCSSWarn, staticDir, nil)
+	if err != nil {
+		t.Errorf("warn mode returned error: %v", err)
+	}
+	if !strings.Contains(warning, "css/theme.css") {
+		t.Errorf("warn mode warning = %q, want it to name the stale CSS", warning)
+	}
+}
+
+func TestCompileSCSS(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake sass is a shell script")
+	}
+	staticDir := writeSCSSProject(t)
+
+	// A stand-in for Dart Sass that copies the input to the output,
+	// installed where node_modules/.bin/sass would be.
+	loadPath := t.TempDir()
+	script := "#!/bin/sh\nfor last; do :; done\nfor a; do case $a in *.scss) in=$a;; esac; done\ncp \"$in\" \"$last\"\n"
+	if err := writeFile(filepath.Join(loadPath, ".bin", "sass"), script); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(filepath.Join(loadPath, ".bin", "sass"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CompileSCSS(staticDir, []string{loadPath}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(staticDir, "css", "theme.min.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "@use") {
+		t.Errorf("theme.min.css = %q, want compiled from theme.scss", data)
+	}
+	stale, err := StaleSCSS(staticDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 0 {
+		t.Errorf("stale = %v, want none after compiling", stale)
+	}
+
+	// Compile mode leaves up-to-date CSS alone
+	info, err := os.Stat(filepath.Join(staticDir, "css", "theme.min.css"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(loadPath, ".bin", "sass")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := checkSCSS(SCSSCompile, staticDir, []string{loadPath}); err != nil {
+		t.Errorf("compile mode with fresh CSS: %v", err)
+	}
+	if again, err := os.Stat(filepath.Join(staticDir, "css", "theme.min.css")); err != nil || !again.ModTime().Equal(info.ModTime()) {
+		t.Error("compile mode rewrote up-to-date CSS")
+	}
+}
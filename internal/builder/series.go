@@ -0,0 +1,66 @@
+package builder
+
+import (
+	"math"
+	"sort"
+
+	"billiemuk/internal/content"
+	"billiemuk/internal/templates"
+)
+
+// groupSeries links posts that share a series name. posts and postData must
+// be index-aligned. Each series is ordered by series_order, falling back to
+// date for posts without an explicit order.
+func groupSeries(posts []content.Post, postData []templates.PostData) []*templates.SeriesData {
+	var series []*templates.SeriesData
+	members := make(map[string][]int)
+	bySlug := make(map[string]*templates.SeriesData)
+
+	for i, p := range posts {
+		if p.Series == "" {
+			continue
+		}
+		slug := content.Slugify(p.Series)
+		if _, ok := bySlug[slug]; !ok {
+			s := &templates.SeriesData{Name: p.Series, Slug: slug}
+			bySlug[slug] = s
+			series = append(series, s)
+		}
+		members[slug] = append(members[slug], i)
+	}
+
+	for _, s := range series {
+		idx := members[s.Slug]
+		sort.SliceStable(idx, func(a, b int) bool {
+			pa, pb := posts[idx[a]], posts[idx[b]]
+			oa, ob := seriesOrder(pa), seriesOrder(pb)
+			if oa != ob {
+				return oa < ob
+			}
+			return pa.Date.Before(pb.Date)
+		})
+
+		for _, i := range idx {
+			s.Posts = append(s.Posts, postData[i])
+		}
+		for part, i := range idx {
+			postData[i].Series = s
+			postData[i].SeriesPart = part + 1
+			if part > 0 {
+				postData[i].SeriesPrev = &s.Posts[part-1]
+			}
+			if part < len(idx)-1 {
+				postData[i].SeriesNext = &s.Posts[part+1]
+			}
+		}
+	}
+
+	return series
+}
+
+func seriesOrder(p content.Post) int {
+	if p.SeriesOrder == 0 {
+		return math.MaxInt
+	}
+	return p.SeriesOrder
+}
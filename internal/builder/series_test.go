@@ -0,0 +1,94 @@
+package builder
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"billiemuk/internal/content"
+	"billiemuk/internal/dist"
+	"billiemuk/internal/templates"
+)
+
+func TestGroupSeries(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	// Newest first, as returned by content.ParseAllPosts
+	posts := []content.Post{
+		{Slug: "part-three", Date: day(20), Series: "Go Tour"},
+		{Slug: "unrelated", Date: day(15)},
+		{Slug: "part-two", Date: day(12), Series: "Go Tour", SeriesOrder: 2},
+		{Slug: "part-one", Date: day(10), Series: "Go Tour", SeriesOrder: 1},
+	}
+	postData := make([]templates.PostData, len(posts))
+	for i, p := range posts {
+		postData[i] = templates.PostData{Slug: p.Slug, Date: p.Date}
+	}
+
+	series := groupSeries(posts, postData)
+	if len(series) != 1 {
+		t.Fatalf("got %d series, want 1", len(series))
+	}
+	s := series[0]
+	if s.Slug != "go-tour" {
+		t.Errorf("slug = %q, want %q", s.Slug, "go-tour")
+	}
+
+	var order []string
+	for _, p := range s.Posts {
+		order = append(order, p.Slug)
+	}
+	want := []string{"part-one", "part-two", "part-three"}
+	if len(order) != len(want) {
+		t.Fatalf("order = %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v, want %v", order, want)
+		}
+	}
+
+	two := postData[2]
+	if two.SeriesPart != 2 {
+		t.Errorf("part = %d, want 2", two.SeriesPart)
+	}
+	if two.SeriesPrev == nil || two.SeriesPrev.Slug != "part-one" {
+		t.Errorf("prev = %v, want part-one", two.SeriesPrev)
+	}
+	if two.SeriesNext == nil || two.SeriesNext.Slug != "part-three" {
+		t.Errorf("next = %v, want part-three", two.SeriesNext)
+	}
+	if postData[3].SeriesPrev != nil {
+		t.Error("first part should have no previous post")
+	}
+	if postData[1].Series != nil {
+		t.Error("unrelated post should not belong to a series")
+	}
+}
+
+func TestSitemapListsSeries(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 0, 0, 0, 0, time.UTC) }
+	distDir := t.TempDir()
+	posts := []content.Post{
+		{Slug: "part-two", Date: day(12), Series: "Go Tour"},
+		{Slug: "part-one", Date: day(10), Series: "Go Tour"},
+		{Slug: "secret", Date: day(8), Series: "Hidden", Draft: true},
+	}
+	cfg := Config{Site: templates.SiteData{BaseURL: "https://example.com"}}
+	if err := generateSEO(cfg, newOutput(dist.Dir(distDir), false), posts); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(distDir, "sitemap.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sitemap := string(data)
+	if strings.Count(sitemap, "https://example.com/series/go-tour/") != 1 {
+		t.Errorf("sitemap should list the series once:\n%s", sitemap)
+	}
+	if strings.Contains(sitemap, "/series/hidden/") {
+		t.Error("sitemap lists a series with only drafts")
+	}
+}
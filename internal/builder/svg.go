@@ -0,0 +1,231 @@
+package builder
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/tdewolff/parse/v2"
+	xmllex "github.com/tdewolff/parse/v2/xml"
+)
+
+const mediaSVG = "image/svg+xml"
+
+// unsafeSVGElements can run script or embed arbitrary HTML, and are
+// removed with everything inside them when sanitising.
+var unsafeSVGElements = map[string]bool{
+	"script":        true,
+	"foreignobject": true,
+}
+
+// animationElements can change another attribute, such as a link's href,
+// while the SVG is displayed.
+var animationElements = map[string]bool{
+	"animate": true,
+	"set":     true,
+}
+
+// prepareSVG checks that data is a well-formed SVG document and, when
+// sanitize is set, strips anything that can run script. Entities declared
+// in a DOCTYPE, as exported by Illustrator, are expanded and the DOCTYPE
+// removed.
+func prepareSVG(data []byte, sanitize bool) ([]byte, error) {
+	data, err := expandDTDEntities(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateSVG(data); err != nil {
+		return nil, err
+	}
+	if !sanitize {
+		return data, nil
+	}
+	return sanitizeSVG(data)
+}
+
+var (
+	doctypeRe = regexp.MustCompile(`(?s)<!DOCTYPE\s[^\[>]*(?:\[(.*?)\])?\s*>`)
+	entityRe  = regexp.MustCompile(`<!ENTITY\s+([\w.:-]+)\s+(?:"([^"]*)"|'([^']*)')\s*>`)
+)
+
+// maxEntityExpansion bounds how much expanding DTD entities may grow an
+// SVG, guarding against entities that nest exponentially.
+const maxEntityExpansion = 10
+
+// expandDTDEntities removes the DOCTYPE from data, replacing references
+// to the general entities declared in its internal subset with their
+// values. Data without a DOCTYPE is returned unchanged.
+func expandDTDEntities(data []byte) ([]byte, error) {
+	loc := doctypeRe.FindSubmatchIndex(data)
+	if loc == nil {
+		return data, nil
+	}
+	var subset []byte
+	if loc[2] >= 0 {
+		subset = data[loc[2]:loc[3]]
+	}
+	out := append(append([]byte{}, data[:loc[0]]...), data[loc[1]:]...)
+
+	var refs []string
+	for _, m := range entityRe.FindAllSubmatch(subset, -1) {
+		value := m[2]
+		if value == nil {
+			value = m[3]
+		}
+		refs = append(refs, "&"+string(m[1])+";", string(value))
+	}
+	if len(refs) == 0 {
+		return out, nil
+	}
+
+	// Entity values may refer to other entities, so expand until nothing
+	// changes
+	r := strings.NewReplacer(refs...)
+	limit := len(data) * maxEntityExpansion
+	for i := 0; i < len(refs); i++ {
+		expanded := r.Replace(string(out))
+		if len(expanded) > limit {
+			return nil, fmt.Errorf("invalid SVG: DTD entities expand to more than %d bytes", limit)
+		}
+		if expanded == string(out) {
+			break
+		}
+		out = []byte(expanded)
+	}
+	return out, nil
+}
+
+// validateSVG reports whether data parses as XML with an <svg> root.
+func validateSVG(data []byte) error {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Entity = xml.HTMLEntity
+	root := ""
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid SVG: %w", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok && root == "" {
+			root = start.Name.Local
+		}
+	}
+	if root != "svg" {
+		return fmt.Errorf("invalid SVG: root element is %q, not svg", root)
+	}
+	return nil
+}
+
+// sanitizeSVG removes script and foreignObject elements, animations of
+// links, event handler attributes and javascript: links, leaving
+// everything else byte for byte.
+func sanitizeSVG(data []byte) ([]byte, error) {
+	l := xmllex.NewLexer(parse.NewInputBytes(data))
+	var out bytes.Buffer
+
+	// skip counts how deep we are inside a removed element
+	skip := 0
+	// An animation's start tag is held back until its attributes show
+	// whether it targets a link
+	var held []byte
+	holding, dropHeld := false, false
+	for {
+		tt, raw := l.Next()
+		switch tt {
+		case xmllex.ErrorToken:
+			if errors.Is(l.Err(), io.EOF) {
+				return out.Bytes(), nil
+			}
+			return nil, fmt.Errorf("invalid SVG: %w", l.Err())
+		case xmllex.StartTagToken:
+			name := localName(l.Text())
+			if skip > 0 || unsafeSVGElements[name] {
+				skip++
+				continue
+			}
+			if animationElements[name] {
+				held = append(held[:0], raw...)
+				holding, dropHeld = true, false
+				continue
+			}
+		case xmllex.StartTagCloseToken, xmllex.StartTagCloseVoidToken:
+			if holding {
+				holding = false
+				switch {
+				case !dropHeld:
+					out.Write(held)
+				case tt == xmllex.StartTagCloseToken:
+					skip = 1
+					continue
+				default:
+					continue
+				}
+			} else if skip > 0 {
+				if tt == xmllex.StartTagCloseVoidToken {
+					skip--
+				}
+				continue
+			}
+		case xmllex.EndTagToken:
+			if skip > 0 {
+				skip--
+				continue
+			}
+		case xmllex.AttributeToken:
+			if skip > 0 || unsafeSVGAttribute(l.Text(), l.AttrVal()) {
+				continue
+			}
+			if holding {
+				if localName(l.Text()) == "attributename" && localName([]byte(attrValue(l.AttrVal()))) == "href" {
+					dropHeld = true
+				}
+				held = append(held, raw...)
+				continue
+			}
+		}
+		if skip == 0 {
+			out.Write(raw)
+		}
+	}
+}
+
+// localName lowercases an element or attribute name and drops any
+// namespace prefix.
+func localName(name []byte) string {
+	s := strings.ToLower(string(name))
+	if i := strings.LastIndexByte(s, ':'); i >= 0 {
+		s = s[i+1:]
+	}
+	return s
+}
+
+func unsafeSVGAttribute(name, quotedVal []byte) bool {
+	n := localName(name)
+	if strings.HasPrefix(n, "on") {
+		return true
+	}
+	if n != "href" {
+		return false
+	}
+	// Browsers ignore whitespace and control characters in the scheme
+	val := strings.Map(func(r rune) rune {
+		if r <= ' ' {
+			return -1
+		}
+		return r
+	}, attrValue(quotedVal))
+	return strings.HasPrefix(strings.ToLower(val), "javascript:")
+}
+
+// attrValue returns an attribute's value without its quotes and with
+// character references decoded.
+func attrValue(quotedVal []byte) string {
+	return html.UnescapeString(strings.Trim(string(quotedVal), `"'`))
+}
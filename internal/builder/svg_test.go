@@ -0,0 +1,168 @@
+package builder
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"billiemuk/internal/dist"
+)
+
+const unsafeSVG = `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" viewBox="0 0 10 10" onload="alert(1)">
+  <script type="text/javascript"><![CDATA[ alert(2) ]]></script>
+  <foreignObject width="10" height="10"><div xmlns="http://www.w3.org/1999/xhtml"><p>hi</p></div></foreignObject>
+  <a xlink:href=" JavaScript:alert(3)"><circle cx="5" cy="5" r="4" fill="red" onclick="alert(4)"/></a>
+  <a href="&#106;avascript:alert(5)"><rect width="1" height="1"/></a>
+  <a id="link" href="/posts/"><rect width="2" height="2"/><set attributeName="href" to="javascript:alert(6)"/></a>
+  <animate xlink:href="#link" attributeName="xlink:href" values="javascript:alert(7)"><desc>x</desc></animate>
+  <animate attributeName="opacity" from="0" to="1" dur="1s"/>
+</svg>
+`
+
+func TestSanitizeSVG(t *testing.T) {
+	got, err := prepareSVG([]byte(unsafeSVG), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(got)
+	for _, unwanted := range []string{"alert", "<script", "foreignObject", "<div", "onload", "onclick", "JavaScript:", "avascript", "<set", "<desc"} {
+		if strings.Contains(s, unwanted) {
+			t.Errorf("sanitised SVG still contains %q:\n%s", unwanted, s)
+		}
+	}
+	for _, want := range []string{`<circle cx="5" cy="5" r="4" fill="red"/>`, `<a id="link" href="/posts/">`, `<a><rect width="1" height="1"/></a>`, `<animate attributeName="opacity" from="0" to="1" dur="1s"/>`, `viewBox="0 0 10 10"`} {
+		if !strings.Contains(s, want) {
+			t.Errorf("sanitised SVG missing %q:\n%s", want, s)
+		}
+	}
+	if err := validateSVG(got); err != nil {
+		t.Errorf("sanitised SVG is invalid: %v", err)
+	}
+
+	kept, err := prepareSVG([]byte(unsafeSVG), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(kept) != unsafeSVG {
+		t.Error("SVG changed without sanitising")
+	}
+}
+
+func TestPrepareSVGExpandsDTDEntities(t *testing.T) {
+	data := `<?xml version="1.0" encoding="utf-8"?>
+<!DOCTYPE svg PUBLIC "-//W3C//DTD SVG 1.1//EN" "http://www.w3.org/Graphics/SVG/1.1/DTD/svg11.dtd" [
+	<!ENTITY ns_svg "http://www.w3.org/2000/svg">
+	<!ENTITY js "java&#115;cript">
+	<!ENTITY link "&js;:alert(1)">
+]>
+<svg xmlns="&ns_svg;" viewBox="0 0 10 10"><a href="&link;"><rect width="2" height="2"/></a></svg>
+`
+	got, err := prepareSVG([]byte(data), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(got)
+	if strings.Contains(s, "DOCTYPE") || strings.Contains(s, "alert") {
+		t.Errorf("prepared SVG = %s", s)
+	}
+	if !strings.Contains(s, `<svg xmlns="http://www.w3.org/2000/svg"`) {
+		t.Errorf("entity not expanded:\n%s", s)
+	}
+
+	bomb := `<!DOCTYPE svg [
+	<!ENTITY a "aaaaaaaaaa">
+	<!ENTITY b "&a;&a;&a;&a;&a;&a;&a;&a;&a;&a;">
+	<!ENTITY c "&b;&b;&b;&b;&b;&b;&b;&b;&b;&b;">
+	<!ENTITY d "&c;&c;&c;&c;&c;&c;&c;&c;&c;&c;">
+]>
+<svg xmlns="http://www.w3.org/2000/svg">&d;&d;&d;&d;</svg>`
+	if _, err := prepareSVG([]byte(bomb), false); err == nil {
+		t.Error("prepareSVG() accepted exponentially nested entities")
+	}
+}
+
+func TestValidateSVG(t *testing.T) {
+	for name, data := range map[string]string{
+		"unclosed":  `<svg xmlns="http://www.w3.org/2000/svg"><g></svg>`,
+		"not svg":   `<html><body/></html>`,
+		"not xml":   `GIF89a`,
+		"truncated": `<svg xmlns="http://www.w3.org/2000/svg"`,
+	} {
+		if err := validateSVG([]byte(data)); err == nil {
+			t.Errorf("%s: validateSVG() = nil, want an error", name)
+		}
+	}
+	if err := validateSVG([]byte(`<svg xmlns="http://www.w3.org/2000/svg">&copy;</svg>`)); err != nil {
+		t.Errorf("validateSVG() with an HTML entity = %v", err)
+	}
+}
+
+func TestProcessImagesMinifiesSVG(t *testing.T) {
+	root := t.TempDir()
+	imagesDir := filepath.Join(root, "content", "images")
+	distDir := filepath.Join(root, "dist")
+	if err := os.MkdirAll(imagesDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(imagesDir, "diagram.svg"), []byte(unsafeSVG), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{sanitizeSVG: true}); err != nil {
+		t.Fatal(err)
+	}
+	got := readFile(t, filepath.Join(distDir, "images", "diagram.svg"))
+	if len(got) >= len(unsafeSVG) || strings.Contains(got, "\n  ") {
+		t.Errorf("SVG not minified:\n%s", got)
+	}
+	if strings.Contains(got, "alert") {
+		t.Errorf("SVG not sanitised:\n%s", got)
+	}
+
+	// original: true skips minifying but not sanitising
+	if err := os.WriteFile(filepath.Join(imagesDir, "diagram.svg.yaml"), []byte("original: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{sanitizeSVG: true}); err != nil {
+		t.Fatal(err)
+	}
+	got = readFile(t, filepath.Join(distDir, "images", "diagram.svg"))
+	if strings.Contains(got, "alert") {
+		t.Errorf("original SVG not sanitised:\n%s", got)
+	}
+	if !strings.Contains(got, "\n  ") {
+		t.Errorf("original SVG was minified:\n%s", got)
+	}
+
+	if err := os.WriteFile(filepath.Join(imagesDir, "broken.svg"), []byte("<svg><g></svg>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := processImages(context.Background(), 0, filepath.Join(root, "content"), newOutput(dist.Dir(distDir), false), ImageConfig{})
+	if err == nil || !strings.Contains(err.Error(), "broken.svg") {
+		t.Errorf("processImages() with a broken SVG = %v, want an error naming it", err)
+	}
+}
+
+func TestProcessStaticSanitizesSVG(t *testing.T) {
+	staticDir := filepath.Join(t.TempDir(), "static")
+	if err := os.MkdirAll(filepath.Join(staticDir, "icons"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Pass-through files are sanitised too
+	if err := os.WriteFile(filepath.Join(staticDir, "icons", "logo.min.svg"), []byte(unsafeSVG), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	distDir := t.TempDir()
+	assets, _, err := processStatic(context.Background(), 0, []string{staticDir}, newOutput(dist.Dir(distDir), false), AssetConfig{sanitizeSVG: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readFile(t, filepath.Join(distDir, "static", filepath.FromSlash(assets["icons/logo.min.svg"].Path)))
+	if strings.Contains(got, "alert") {
+		t.Errorf("static SVG not sanitised:\n%s", got)
+	}
+}
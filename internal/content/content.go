@@ -5,76 +5,128 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/parser"
 	"go.abhg.dev/goldmark/frontmatter"
 )
 
 type Post struct {
-	Title   string
-	Date    time.Time
-	Summary string
-	Draft   bool
-	Slug    string
-	HTML    string
+	Title       string
+	Date        time.Time
+	Summary     string
+	Draft       bool
+	Slug        string
+	Tags        []string
+	Series      string
+	SeriesOrder int
+	Layout      string
+	HTML        string
+	// HasAnimations is set when HTML contains click-to-play animations,
+	// which need the GIF player script.
+	HasAnimations bool
 }
 
 type postFrontmatter struct {
-	Title   string `yaml:"title"`
-	Date    string `yaml:"date"`
-	Summary string `yaml:"summary"`
-	Draft   bool   `yaml:"draft"`
+	Title       string   `yaml:"title"`
+	Date        string   `yaml:"date"`
+	Summary     string   `yaml:"summary"`
+	Draft       bool     `yaml:"draft"`
+	Tags        []string `yaml:"tags"`
+	Series      string   `yaml:"series"`
+	SeriesOrder int      `yaml:"series_order"`
+	Layout      string   `yaml:"layout"`
 }
 
+// PostError is an error in a post's source, with the line it was found on
+// when known.
+type PostError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *PostError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%s:%d: %v", e.Path, e.Line, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e *PostError) Unwrap() error { return e.Err }
+
+// Location returns the file and line the error was found on; line is 0
+// when unknown.
+func (e *PostError) Location() (string, int) { return e.Path, e.Line }
+
 func ParsePost(path string) (Post, error) {
+	return ParsePostWith(path, Options{})
+}
+
+// ParsePostWith parses the post at path, rendering its markdown with opts.
+func ParsePostWith(path string, opts Options) (Post, error) {
 	src, err := os.ReadFile(path)
 	if err != nil {
 		return Post{}, fmt.Errorf("read post: %w", err)
 	}
 
-	md := goldmark.New(
-		goldmark.WithExtensions(&frontmatter.Extender{}),
-	)
+	md := newMarkdown(opts, &frontmatter.Extender{})
 
 	ctx := parser.NewContext()
 	var buf bytes.Buffer
 	if err := md.Convert(src, &buf, parser.WithContext(ctx)); err != nil {
-		return Post{}, fmt.Errorf("convert markdown: %w", err)
+		return Post{}, &PostError{path, 0, fmt.Errorf("convert markdown: %w", err)}
 	}
 
 	fm := frontmatter.Get(ctx)
 	if fm == nil {
-		return Post{}, fmt.Errorf("no frontmatter found in %s", path)
+		return Post{}, &PostError{path, 1, fmt.Errorf("no frontmatter found")}
 	}
 
 	var meta postFrontmatter
 	if err := fm.Decode(&meta); err != nil {
-		return Post{}, fmt.Errorf("decode frontmatter: %w", err)
+		return Post{}, &PostError{path, yamlErrorLine(err), fmt.Errorf("decode frontmatter: %w", err)}
 	}
 
 	date, err := time.Parse("2006-01-02", meta.Date)
 	if err != nil {
-		return Post{}, fmt.Errorf("parse date %q: %w", meta.Date, err)
+		return Post{}, &PostError{path, frontmatterLine(src, "date"), fmt.Errorf("parse date %q: %w", meta.Date, err)}
+	}
+
+	// The series page lives at /series/<slug>/, so a name has to give one
+	series := strings.TrimSpace(meta.Series)
+	if series != "" && Slugify(series) == "" {
+		return Post{}, &PostError{path, frontmatterLine(src, "series"), fmt.Errorf("series %q needs at least one ASCII letter or digit for its URL", series)}
 	}
 
 	filename := filepath.Base(path)
 	slug := strings.TrimSuffix(filename, filepath.Ext(filename))
 
 	return Post{
-		Title:   meta.Title,
-		Date:    date,
-		Summary: meta.Summary,
-		Draft:   meta.Draft,
-		Slug:    slug,
-		HTML:    buf.String(),
+		Title:         meta.Title,
+		Date:          date,
+		Summary:       meta.Summary,
+		Draft:         meta.Draft,
+		Slug:          slug,
+		Tags:          normalizeTags(meta.Tags),
+		Series:        series,
+		SeriesOrder:   meta.SeriesOrder,
+		Layout:        strings.TrimSpace(meta.Layout),
+		HTML:          buf.String(),
+		HasAnimations: ctx.Get(animationsKey) == true,
 	}, nil
 }
 
 func ParseAllPosts(dir string, includeDrafts bool) ([]Post, error) {
+	return ParseAllPostsWith(dir, Options{IncludeDrafts: includeDrafts})
+}
+
+// ParseAllPostsWith parses every post in dir with opts, newest first.
+func ParseAllPostsWith(dir string, opts Options) ([]Post, error) {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return nil, fmt.Errorf("read posts dir: %w", err)
@@ -85,11 +137,11 @@ func ParseAllPosts(dir string, includeDrafts bool) ([]Post, error) {
 		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".md") {
 			continue
 		}
-		post, err := ParsePost(filepath.Join(dir, entry.Name()))
+		post, err := ParsePostWith(filepath.Join(dir, entry.Name()), opts)
 		if err != nil {
 			return nil, err
 		}
-		if post.Draft && !includeDrafts {
+		if post.Draft && !opts.IncludeDrafts {
 			continue
 		}
 		posts = append(posts, post)
@@ -102,6 +154,50 @@ func ParseAllPosts(dir string, includeDrafts bool) ([]Post, error) {
 	return posts, nil
 }
 
+var yamlLineRe = regexp.MustCompile(`line (\d+):`)
+
+// yamlErrorLine returns the line of the post a frontmatter decoding error
+// refers to, or 0 when it names none. YAML counts lines from the first
+// line after the opening "---".
+func yamlErrorLine(err error) int {
+	m := yamlLineRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	n, _ := strconv.Atoi(m[1])
+	return n + 1
+}
+
+// frontmatterLine returns the line of src that sets key in the
+// frontmatter, or 0 when it is not set.
+func frontmatterLine(src []byte, key string) int {
+	lines := strings.Split(string(src), "\n")
+	for i, line := range lines[min(1, len(lines)):] {
+		if strings.TrimSpace(line) == "---" {
+			break
+		}
+		if strings.HasPrefix(line, key+":") {
+			return i + 2
+		}
+	}
+	return 0
+}
+
+// normalizeTags lowercases and trims tags, dropping blanks and duplicates.
+func normalizeTags(tags []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range tags {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
+
 func Slugify(s string) string {
 	s = strings.ToLower(s)
 	var result strings.Builder
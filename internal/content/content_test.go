@@ -1,6 +1,7 @@
 package content
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"testing"
@@ -76,6 +77,70 @@ Content.
 	}
 }
 
+func TestParsePostSeriesAndLayout(t *testing.T) {
+	dir := t.TempDir()
+	md := `---
+title: "Part Two"
+date: 2026-01-15
+series: "Go Tour"
+series_order: 2
+layout: wide
+---
+
+Content.
+`
+	path := filepath.Join(dir, "2026-01-15-part-two.md")
+	if err := os.WriteFile(path, []byte(md), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := ParsePost(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if post.Series != "Go Tour" {
+		t.Errorf("series = %q, want %q", post.Series, "Go Tour")
+	}
+	if post.SeriesOrder != 2 {
+		t.Errorf("series order = %d, want 2", post.SeriesOrder)
+	}
+	if post.Layout != "wide" {
+		t.Errorf("layout = %q, want %q", post.Layout, "wide")
+	}
+}
+
+func TestParsePostTags(t *testing.T) {
+	dir := t.TempDir()
+	md := `---
+title: "Tagged"
+date: 2026-01-15
+tags: ["Go", " go ", "Static Sites", ""]
+---
+
+Content.
+`
+	path := filepath.Join(dir, "2026-01-15-tagged.md")
+	if err := os.WriteFile(path, []byte(md), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := ParsePost(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"go", "static sites"}
+	if len(post.Tags) != len(want) {
+		t.Fatalf("tags = %q, want %q", post.Tags, want)
+	}
+	for i := range want {
+		if post.Tags[i] != want[i] {
+			t.Errorf("tags[%d] = %q, want %q", i, post.Tags[i], want[i])
+		}
+	}
+}
+
 func TestParseAllPosts(t *testing.T) {
 	dir := t.TempDir()
 
@@ -114,3 +179,31 @@ func TestParseAllPosts(t *testing.T) {
 		t.Fatalf("got %d posts, want 3", len(result))
 	}
 }
+
+func TestParsePostErrorLine(t *testing.T) {
+	tests := []struct {
+		name, md string
+		line     int
+	}{
+		{"bad date", "---\ntitle: \"x\"\ndate: yesterday\n---\n", 3},
+		{"bad yaml", "---\ntitle: \"x\"\ndate: 2026-01-15\nseries_order: two\n---\n", 4},
+		{"no frontmatter", "Just text.\n", 1},
+		{"unsluggable series", "---\ntitle: \"x\"\ndate: 2026-01-15\nseries: \"日本語\"\n---\n", 4},
+		{"punctuation series", "---\ntitle: \"x\"\ndate: 2026-01-15\nseries: \"!!!\"\n---\n", 4},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "post.md")
+		if err := os.WriteFile(path, []byte(tt.md), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := ParsePost(path)
+		var perr *PostError
+		if !errors.As(err, &perr) {
+			t.Errorf("%s: error = %v, want *PostError", tt.name, err)
+			continue
+		}
+		if file, line := perr.Location(); file != path || line != tt.line {
+			t.Errorf("%s: location = %s:%d, want %s:%d (%v)", tt.name, file, line, path, tt.line, err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package content
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Options control how posts are parsed.
+type Options struct {
+	IncludeDrafts bool
+	// Images describes the processed images posts may reference, keyed by
+	// their path under the content directory, e.g. "images/demo.gif".
+	Images map[string]Image
+}
+
+// Image describes a processed image.
+type Image struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// Poster is the file name of a still frame of an animated image, in
+	// the same directory as the image.
+	Poster string `json:"poster,omitempty"`
+	// Color is the image's dominant colour as a CSS hex colour.
+	Color string `json:"color,omitempty"`
+	// Placeholder is a data URI of a tiny thumbnail shown, blurred by
+	// scaling, while the image loads. Images with transparency have none.
+	Placeholder string `json:"placeholder,omitempty"`
+}
+
+// PlaceholderStyle returns inline CSS showing the image's placeholder
+// behind it until it loads, or "" when it has none.
+func (img Image) PlaceholderStyle() string {
+	if img.Placeholder == "" {
+		return ""
+	}
+	return fmt.Sprintf("background-color:%s;background-image:url(%s);background-size:cover", img.Color, img.Placeholder)
+}
+
+// lookupImage returns what is known about the image at a markdown
+// destination such as "/images/demo.gif".
+func (o Options) lookupImage(dest string) (Image, bool) {
+	img, ok := o.Images[strings.TrimPrefix(dest, "/")]
+	return img, ok
+}
+
+// newMarkdown returns the markdown converter for posts.
+func newMarkdown(opts Options, extensions ...goldmark.Extender) goldmark.Markdown {
+	extensions = append(extensions, &imageExtension{opts})
+	return goldmark.New(goldmark.WithExtensions(extensions...))
+}
+
+// imageExtension adds the size and placeholder of known images, and
+// renders an animated image that stands alone in a paragraph as a figure
+// showing its poster frame, which plays the animation when clicked.
+type imageExtension struct {
+	opts Options
+}
+
+func (e *imageExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(e, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(e, 100)))
+}
+
+var kindAnimation = ast.NewNodeKind("Animation")
+
+// animationsKey is set in the parser context when a document has any
+// click-to-play animations.
+var animationsKey = parser.NewContextKey()
+
+// animation is a click-to-play figure replacing a paragraph holding only
+// an animated image.
+type animation struct {
+	ast.BaseBlock
+	src    string
+	poster string
+	alt    string
+	title  string
+	image  Image
+}
+
+func (n *animation) Kind() ast.NodeKind { return kindAnimation }
+
+func (n *animation) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Src": n.src, "Poster": n.poster}, nil)
+}
+
+func (e *imageExtension) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var paragraphs []*ast.Paragraph
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if p, ok := n.(*ast.Paragraph); ok && entering && p.ChildCount() == 1 {
+			paragraphs = append(paragraphs, p)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	// Known images get their size, lazy loading and a placeholder
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		img, ok := n.(*ast.Image)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		if info, ok := e.opts.lookupImage(string(img.Destination)); ok {
+			if info.Width > 0 && info.Height > 0 {
+				img.SetAttributeString("width", []byte(strconv.Itoa(info.Width)))
+				img.SetAttributeString("height", []byte(strconv.Itoa(info.Height)))
+			}
+			img.SetAttributeString("loading", []byte("lazy"))
+			img.SetAttributeString("decoding", []byte("async"))
+			if style := info.PlaceholderStyle(); style != "" {
+				img.SetAttributeString("style", []byte(style))
+			}
+		}
+		return ast.WalkSkipChildren, nil
+	})
+
+	source := reader.Source()
+	for _, p := range paragraphs {
+		img, ok := p.FirstChild().(*ast.Image)
+		if !ok {
+			continue
+		}
+		dest := string(img.Destination)
+		info, ok := e.opts.lookupImage(dest)
+		if !ok || info.Poster == "" {
+			continue
+		}
+		pc.Set(animationsKey, true)
+		p.Parent().ReplaceChild(p.Parent(), p, &animation{
+			src:    dest,
+			poster: path.Join(path.Dir(dest), info.Poster),
+			alt:    plainText(img, source),
+			title:  string(img.Title),
+			image:  info,
+		})
+	}
+}
+
+func (e *imageExtension) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindAnimation, renderAnimation)
+}
+
+func renderAnimation(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*animation)
+	fmt.Fprintf(w, `<figure class="gif-player"><a href="%s" title="Play animation">`, escapeURL(n.src))
+	fmt.Fprintf(w, `<img src="%s" alt="%s"`, escapeURL(n.poster), util.EscapeHTML([]byte(n.alt)))
+	if n.image.Width > 0 && n.image.Height > 0 {
+		fmt.Fprintf(w, ` width="%d" height="%d"`, n.image.Width, n.image.Height)
+	}
+	w.WriteString(` loading="lazy" decoding="async"`)
+	if style := n.image.PlaceholderStyle(); style != "" {
+		fmt.Fprintf(w, ` style="%s"`, util.EscapeHTML([]byte(style)))
+	}
+	w.WriteString(`></a>`)
+	if n.title != "" {
+		fmt.Fprintf(w, "<figcaption>%s</figcaption>", util.EscapeHTML([]byte(n.title)))
+	}
+	w.WriteString("</figure>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+func escapeURL(s string) []byte {
+	return util.EscapeHTML(util.URLEscape([]byte(s), true))
+}
+
+// plainText returns the text content of n, such as an image's alt text.
+func plainText(n ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if t, ok := c.(*ast.Text); ok && entering {
+			b.Write(t.Segment.Value(source))
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
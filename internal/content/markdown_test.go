@@ -0,0 +1,75 @@
+package content
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePostAnimatedImageFigure(t *testing.T) {
+	dir := t.TempDir()
+	src := `---
+title: "Demo"
+date: 2026-02-01
+---
+
+![Typing a command](/images/demo.gif "The new prompt")
+
+Inline ![still](/images/demo.gif) image and ![photo](/images/photo.jpg).
+`
+	path := filepath.Join(dir, "2026-02-01-demo.md")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := ParsePostWith(path, Options{Images: map[string]Image{
+		"images/demo.gif": {Width: 600, Height: 300, Poster: "demo.poster.png"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`<figure class="gif-player"><a href="/images/demo.gif"`,
+		`<img src="/images/demo.poster.png" alt="Typing a command" width="600" height="300" loading="lazy" decoding="async">`,
+		`<figcaption>The new prompt</figcaption></figure>`,
+		`Inline <img src="/images/demo.gif" alt="still" width="600" height="300" loading="lazy" decoding="async">`,
+		`<img src="/images/photo.jpg" alt="photo">`,
+	} {
+		if !strings.Contains(post.HTML, want) {
+			t.Errorf("HTML missing %q:\n%s", want, post.HTML)
+		}
+	}
+	if strings.Contains(post.HTML, "<p><figure") {
+		t.Errorf("figure nested in a paragraph:\n%s", post.HTML)
+	}
+	if !post.HasAnimations {
+		t.Error("HasAnimations not set for a post with a click-to-play figure")
+	}
+}
+
+func TestParsePostImagePlaceholder(t *testing.T) {
+	dir := t.TempDir()
+	src := "---\ntitle: \"Photo\"\ndate: 2026-02-01\n---\n\n![Harbour](/images/harbour.jpg)\n"
+	path := filepath.Join(dir, "2026-02-01-photo.md")
+	if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	post, err := ParsePostWith(path, Options{Images: map[string]Image{
+		"images/harbour.jpg": {Width: 1200, Height: 800, Color: "#336699", Placeholder: "data:image/png;base64,AAAA"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<img src="/images/harbour.jpg" alt="Harbour" width="1200" height="800" loading="lazy" decoding="async" ` +
+		`style="background-color:#336699;background-image:url(data:image/png;base64,AAAA);background-size:cover">`
+	if !strings.Contains(post.HTML, want) {
+		t.Errorf("HTML missing placeholder image:\n%s", post.HTML)
+	}
+	if post.HasAnimations {
+		t.Error("HasAnimations set for a post without animations")
+	}
+}
@@ -0,0 +1,48 @@
+package dist
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestMem(t *testing.T) {
+	m := NewMem()
+	files := map[string]string{
+		"index.html":              "<h1>home</h1>",
+		"posts/hello/index.html":  "<h1>hello</h1>",
+		"static/css/theme.css":    "body{}",
+		"static/css/theme.css.gz": "gz",
+	}
+	for name, data := range files {
+		if err := m.WriteFile(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fstest.TestFS(m, "index.html", "posts/hello/index.html", "static/css/theme.css"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Open("posts/missing"); !os.IsNotExist(err) {
+		t.Errorf("open missing dir: err = %v, want not exist", err)
+	}
+	if err := m.WriteFile("../escape", nil); err == nil {
+		t.Error("writing outside the root succeeded")
+	}
+}
+
+func TestDir(t *testing.T) {
+	root := t.TempDir()
+	d := Dir(root)
+	if err := d.WriteFile("posts/hello/index.html", []byte("<h1>hello</h1>")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "posts", "hello", "index.html")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(d, "posts/hello/index.html")
+	if err != nil || string(data) != "<h1>hello</h1>" {
+		t.Errorf("read back %q, %v", data, err)
+	}
+}
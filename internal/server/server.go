@@ -1,30 +1,79 @@
 package server
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/fsnotify/fsnotify"
 )
 
+// DefaultDebounce is how long the watcher waits for changes to settle
+// before rebuilding.
+const DefaultDebounce = 100 * time.Millisecond
+
 type Server struct {
+	// DistDir is served until SetFS is called.
 	DistDir   string
 	BuildFn   func() error
 	WatchDirs []string
 	Addr      string
+	// Debounce is how long to wait after a change for further changes
+	// before rebuilding (DefaultDebounce when zero). Changes in that window,
+	// or while a build is running, are coalesced into one rebuild.
+	Debounce time.Duration
 
 	mu      sync.Mutex
-	clients map[chan struct{}]struct{}
+	clients map[chan string]struct{}
+	// pending holds the paths changed since the last successful build.
+	pending map[string]bool
+	// lastError is the build-error event for the failing build, sent to
+	// browsers that connect before the next successful build.
+	lastError string
+	// warning is set by Warn during a build; lastWarning is the
+	// build-warning event for the last successful build.
+	warning     string
+	lastWarning string
+
+	served atomic.Pointer[fs.FS]
+}
+
+// SetFS replaces the files being served with fsys, e.g. once a build into
+// memory succeeds. Requests in flight finish with the files they started
+// with, so browsers never see a half-written build.
+func (s *Server) SetFS(fsys fs.FS) {
+	s.served.Store(&fsys)
+}
+
+// servedFS returns the files currently being served.
+func (s *Server) servedFS() fs.FS {
+	if fsys := s.served.Load(); fsys != nil {
+		return *fsys
+	}
+	return os.DirFS(s.DistDir)
 }
 
 func (s *Server) Handler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/_reload", s.handleSSE)
-	mux.Handle("/", http.FileServer(http.Dir(s.DistDir)))
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fsys := s.servedFS()
+		if serveCompressed(fsys, w, r) {
+			return
+		}
+		http.FileServerFS(fsys).ServeHTTP(w, r)
+	})
 	return mux
 }
 
@@ -39,14 +88,14 @@ func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
-	ch := make(chan struct{}, 1)
+	ch := make(chan string, 4)
 	s.addClient(ch)
 	defer s.removeClient(ch)
 
 	for {
 		select {
-		case <-ch:
-			fmt.Fprintf(w, "data: reload\n\n")
+		case event := <-ch:
+			fmt.Fprint(w, event)
 			flusher.Flush()
 		case <-r.Context().Done():
 			return
@@ -54,32 +103,122 @@ func (s *Server) handleSSE(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) addClient(ch chan struct{}) {
+func (s *Server) addClient(ch chan string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.clients == nil {
-		s.clients = make(map[chan struct{}]struct{})
+		s.clients = make(map[chan string]struct{})
 	}
 	s.clients[ch] = struct{}{}
+	if s.lastError != "" {
+		ch <- s.lastError
+	} else if s.lastWarning != "" {
+		ch <- s.lastWarning
+	}
 }
 
-func (s *Server) removeClient(ch chan struct{}) {
+// Warn records a problem found by the build in progress that didn't fail
+// it, such as stale compiled CSS. Once the build succeeds, browsers show
+// msg until a later build has no warning. BuildFn calls it.
+func (s *Server) Warn(msg string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.warning = msg
+}
+
+func (s *Server) removeClient(ch chan string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.clients, ch)
 }
 
-func (s *Server) notifyClients() {
+// Reload events, telling browsers how much of the page a rebuild changed.
+const (
+	// reloadCSS swaps the page's stylesheets in place.
+	reloadCSS = "css"
+	// reloadPage reloads the page, keeping its scroll position.
+	reloadPage = "page"
+	// reloadFull reloads the page from the top.
+	reloadFull = "full"
+)
+
+// notifyClients tells browsers the build succeeded, sending the reload
+// event kind followed by any warning the build reported.
+func (s *Server) notifyClients(kind string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lastError = ""
+	s.broadcast(sseEvent(kind, "reload"))
+	s.lastWarning = ""
+	if s.warning != "" {
+		s.lastWarning = sseEvent("build-warning", s.warning)
+		s.broadcast(s.lastWarning)
+	}
+}
+
+// notifyError sends browsers a build-error event describing err, which
+// they show as an overlay until the next successful build.
+func (s *Server) notifyError(err error) {
+	data, _ := json.Marshal(describeError(err))
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.lastError = sseEvent("build-error", string(data))
+	s.broadcast(s.lastError)
+}
+
+// broadcast sends event to every client, dropping it for clients too far
+// behind to take it. s.mu must be held.
+func (s *Server) broadcast(event string) {
 	for ch := range s.clients {
 		select {
-		case ch <- struct{}{}:
+		case ch <- event:
 		default:
 		}
 	}
 }
 
+// sseEvent formats a server-sent event. An empty name sends a plain
+// message.
+func sseEvent(name, data string) string {
+	var b strings.Builder
+	if name != "" {
+		fmt.Fprintf(&b, "event: %s\n", name)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// buildError is the payload of a build-error event. File and Line are
+// empty when the error doesn't point at a source file.
+type buildError struct {
+	Message string `json:"message"`
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// templateErrorRe matches the position in text/template and html/template
+// errors, e.g. "template: post.html:12: ...".
+var templateErrorRe = regexp.MustCompile(`template: ([^:\s]+):(\d+):`)
+
+// describeError finds where err was found, from errors that can report
+// their location or from the position in a template error.
+func describeError(err error) buildError {
+	be := buildError{Message: err.Error()}
+	var located interface{ Location() (string, int) }
+	if errors.As(err, &located) {
+		be.File, be.Line = located.Location()
+		return be
+	}
+	if m := templateErrorRe.FindStringSubmatch(be.Message); m != nil {
+		be.File = m[1]
+		be.Line, _ = strconv.Atoi(m[2])
+	}
+	return be
+}
+
 func (s *Server) Start() error {
 	if s.BuildFn == nil {
 		return fmt.Errorf("BuildFn is required")
@@ -90,6 +229,9 @@ func (s *Server) Start() error {
 	if err := s.BuildFn(); err != nil {
 		return fmt.Errorf("initial build: %w", err)
 	}
+	if s.warning != "" {
+		s.lastWarning = sseEvent("build-warning", s.warning)
+	}
 
 	// Start file watcher
 	if err := s.startWatcher(); err != nil {
@@ -112,38 +254,177 @@ func (s *Server) startWatcher() error {
 		return err
 	}
 
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					return
-				}
-				if event.Has(fsnotify.Write) || event.Has(fsnotify.Create) || event.Has(fsnotify.Remove) {
-					log.Printf("Change detected: %s", event.Name)
-					if err := s.BuildFn(); err != nil {
-						log.Printf("Build error: %v", err)
-						continue
+	changes := make(chan string, 1)
+	go s.buildOnChange(changes)
+	go s.watch(watcher, changes)
+
+	for _, dir := range s.WatchDirs {
+		if err := addRecursive(watcher, dir); err != nil {
+			log.Printf("Warning: could not watch %s: %v", dir, err)
+		}
+	}
+
+	return nil
+}
+
+// watch queues a rebuild for every relevant change reported by watcher,
+// keeping directories created or removed while serving in sync with the
+// watch list. It closes changes when the watcher stops.
+func (s *Server) watch(watcher *fsnotify.Watcher, changes chan<- string) {
+	defer close(changes)
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Write|fsnotify.Create|fsnotify.Remove|fsnotify.Rename) || isEditorTemp(event.Name) {
+				continue
+			}
+			switch {
+			case event.Has(fsnotify.Create):
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					// Files may already have been written inside it before
+					// the watch was added; the rebuild picks them up
+					if err := addRecursive(watcher, event.Name); err != nil {
+						log.Printf("Warning: could not watch %s: %v", event.Name, err)
 					}
-					s.notifyClients()
-					log.Println("Rebuild complete, reloading browsers...")
 				}
-			case err, ok := <-watcher.Errors:
+			case event.Has(fsnotify.Remove | fsnotify.Rename):
+				// Only directories are watched, so this fails harmlessly
+				// for files
+				watcher.Remove(event.Name)
+			}
+			log.Printf("Change detected: %s", event.Name)
+			s.queueChange(changes, event.Name)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Watcher error: %v", err)
+		}
+	}
+}
+
+// isEditorTemp reports whether name is a temporary file written by an
+// editor while saving, such as Vim's swap files and its 4913 write test
+// or backup files ending in ~.
+func isEditorTemp(name string) bool {
+	base := filepath.Base(name)
+	switch {
+	case base == "4913",
+		strings.HasSuffix(base, "~"),
+		strings.HasSuffix(base, ".swp"),
+		strings.HasSuffix(base, ".swo"),
+		strings.HasSuffix(base, ".swx"):
+		return true
+	}
+	return false
+}
+
+// queueChange records a changed path and hands it to buildOnChange
+// without blocking. If a change is already queued the rebuild it triggers
+// covers this one too, so it is dropped from the channel.
+func (s *Server) queueChange(changes chan<- string, name string) {
+	s.mu.Lock()
+	if s.pending == nil {
+		s.pending = make(map[string]bool)
+	}
+	s.pending[name] = true
+	s.mu.Unlock()
+
+	select {
+	case changes <- name:
+	default:
+	}
+}
+
+// takePending returns the paths changed since the last successful build
+// and starts collecting afresh.
+func (s *Server) takePending() map[string]bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending := s.pending
+	s.pending = nil
+	return pending
+}
+
+// restorePending puts back the paths of a failed build, so the next
+// successful build reloads browsers for them too.
+func (s *Server) restorePending(paths map[string]bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		s.pending = make(map[string]bool)
+	}
+	for p := range paths {
+		s.pending[p] = true
+	}
+}
+
+// pageExts are the sources that only change page content, so a reload can
+// keep the reader's place.
+var pageExts = map[string]bool{
+	".md": true, ".markdown": true, ".yaml": true, ".yml": true,
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".svg": true, ".webp": true,
+}
+
+// reloadKind picks the reload event for a set of changed paths: CSS when
+// only stylesheets changed, page when only content did, and full for
+// anything else, such as templates or scripts.
+func reloadKind(paths map[string]bool) string {
+	if len(paths) == 0 {
+		return reloadFull
+	}
+	kind := reloadCSS
+	for p := range paths {
+		switch ext := strings.ToLower(filepath.Ext(p)); {
+		case ext == ".scss" || ext == ".css":
+		case pageExts[ext]:
+			kind = reloadPage
+		default:
+			return reloadFull
+		}
+	}
+	return kind
+}
+
+// buildOnChange rebuilds once changes have stopped arriving for the
+// debounce period. Builds run one at a time on this goroutine; changes
+// queued during a build trigger a single rebuild after it.
+func (s *Server) buildOnChange(changes <-chan string) {
+	delay := s.Debounce
+	if delay == 0 {
+		delay = DefaultDebounce
+	}
+
+	for range changes {
+		timer := time.NewTimer(delay)
+	settle:
+		for {
+			select {
+			case _, ok := <-changes:
 				if !ok {
+					timer.Stop()
 					return
 				}
-				log.Printf("Watcher error: %v", err)
+				timer.Reset(delay)
+			case <-timer.C:
+				break settle
 			}
 		}
-	}()
 
-	for _, dir := range s.WatchDirs {
-		if err := addRecursive(watcher, dir); err != nil {
-			log.Printf("Warning: could not watch %s: %v", dir, err)
+		changed := s.takePending()
+		s.Warn("")
+		if err := s.BuildFn(); err != nil {
+			log.Printf("Build error: %v", err)
+			s.restorePending(changed)
+			s.notifyError(err)
+			continue
 		}
+		s.notifyClients(reloadKind(changed))
+		log.Println("Rebuild complete, reloading browsers...")
 	}
-
-	return nil
 }
 
 func addRecursive(watcher *fsnotify.Watcher, root string) error {
@@ -1,11 +1,20 @@
 package server
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"billiemuk/internal/dist"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 func TestServesDistFiles(t *testing.T) {
@@ -44,3 +53,351 @@ func TestSSEEndpoint(t *testing.T) {
 	// For now, verify the endpoint doesn't 404
 	_ = w
 }
+
+func TestServesPrecompressedFiles(t *testing.T) {
+	distDir := t.TempDir()
+	files := map[string]string{
+		"index.html":    "<h1>hello</h1>",
+		"index.html.br": "brotli bytes",
+		"index.html.gz": "gzip bytes",
+		"feed.xml":      "<rss/>",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(distDir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := (&Server{DistDir: distDir}).Handler()
+
+	tests := []struct {
+		path, accept   string
+		body, encoding string
+	}{
+		{"/", "gzip, deflate, br", "brotli bytes", "br"},
+		{"/index.html", "gzip", "gzip bytes", "gzip"},
+		{"/", "br;q=0, gzip", "gzip bytes", "gzip"},
+		{"/", "", "<h1>hello</h1>", ""},
+		{"/feed.xml", "br, gzip", "<rss/>", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept-Encoding", tt.accept)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("%s (%s): status = %d, want 200", tt.path, tt.accept, w.Code)
+		}
+		if w.Body.String() != tt.body {
+			t.Errorf("%s (%s): body = %q, want %q", tt.path, tt.accept, w.Body.String(), tt.body)
+		}
+		if got := w.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s (%s): Content-Encoding = %q, want %q", tt.path, tt.accept, got, tt.encoding)
+		}
+		if tt.encoding != "" && !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("%s (%s): Content-Type = %q, want text/html", tt.path, tt.accept, w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestBuildOnChangeCoalesces(t *testing.T) {
+	var builds, running atomic.Int32
+	var overlapped atomic.Bool
+	s := &Server{
+		Debounce: 20 * time.Millisecond,
+		BuildFn: func() error {
+			if running.Add(1) > 1 {
+				overlapped.Store(true)
+			}
+			time.Sleep(50 * time.Millisecond)
+			running.Add(-1)
+			builds.Add(1)
+			return nil
+		},
+	}
+	changes := make(chan string, 1)
+	done := make(chan struct{})
+	go func() {
+		s.buildOnChange(changes)
+		close(done)
+	}()
+
+	// A burst of events from one save is a single build
+	for i := 0; i < 5; i++ {
+		s.queueChange(changes, "post.md")
+		time.Sleep(2 * time.Millisecond)
+	}
+	time.Sleep(120 * time.Millisecond)
+	if got := builds.Load(); got != 1 {
+		t.Fatalf("builds after a burst = %d, want 1", got)
+	}
+
+	// Changes during a build are coalesced into one more build
+	s.queueChange(changes, "post.md")
+	time.Sleep(40 * time.Millisecond)
+	for i := 0; i < 5; i++ {
+		s.queueChange(changes, "post.md")
+	}
+	time.Sleep(250 * time.Millisecond)
+	if got := builds.Load(); got != 3 {
+		t.Errorf("builds = %d, want 3", got)
+	}
+	if overlapped.Load() {
+		t.Error("two builds ran at once")
+	}
+
+	close(changes)
+	<-done
+}
+
+func TestWatchAddsNewDirectories(t *testing.T) {
+	root := t.TempDir()
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := addRecursive(watcher, root); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan string, 1)
+	s := &Server{}
+	go s.watch(watcher, changes)
+	defer func() {
+		watcher.Close()
+		for range changes {
+		}
+	}()
+
+	next := func() string {
+		t.Helper()
+		select {
+		case name := <-changes:
+			return name
+		case <-time.After(2 * time.Second):
+			t.Fatal("no change reported")
+			return ""
+		}
+	}
+
+	dir := filepath.Join(root, "images", "new-post")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	next()
+	// Let the new directory's watch settle before writing into it
+	time.Sleep(50 * time.Millisecond)
+	for len(changes) > 0 {
+		<-changes
+	}
+
+	// Editor temp files are ignored
+	for _, name := range []string{".post.md.swp", "post.md~", "4913"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(dir, "cover.jpg")
+	if err := os.WriteFile(file, []byte("jpeg"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := next(); got != file {
+		t.Errorf("change = %q, want %q", got, file)
+	}
+}
+
+func TestIsEditorTemp(t *testing.T) {
+	for name, want := range map[string]bool{
+		"content/posts/.hello.md.swp": true,
+		"content/posts/hello.md~":     true,
+		"content/posts/4913":          true,
+		"content/posts/hello.md":      false,
+		"static/css/theme.css":        false,
+	} {
+		if got := isEditorTemp(name); got != want {
+			t.Errorf("isEditorTemp(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestBuildErrorEvents(t *testing.T) {
+	s := &Server{}
+	ch := make(chan string, 4)
+	s.addClient(ch)
+
+	s.notifyError(fmt.Errorf("load templates: %w", errors.New(`template: post.html:12: function "nope" not defined`)))
+	event := <-ch
+	for _, check := range []string{"event: build-error\n", `"file":"post.html"`, `"line":12`, `function \"nope\" not defined`} {
+		if !strings.Contains(event, check) {
+			t.Errorf("event missing %q: %q", check, event)
+		}
+	}
+
+	// Browsers connecting while the build is broken see the error
+	late := make(chan string, 4)
+	s.addClient(late)
+	if got := <-late; got != event {
+		t.Errorf("late client got %q, want %q", got, event)
+	}
+
+	s.notifyClients(reloadFull)
+	if got := <-ch; got != "event: full\ndata: reload\n\n" {
+		t.Errorf("event after success = %q, want reload", got)
+	}
+	s.addClient(make(chan string, 4))
+	if s.lastError != "" {
+		t.Error("error not cleared by successful build")
+	}
+}
+
+func TestBuildWarningEvents(t *testing.T) {
+	s := &Server{}
+	ch := make(chan string, 4)
+	s.addClient(ch)
+
+	s.Warn("compiled CSS is out of date")
+	s.notifyClients(reloadCSS)
+	if got := <-ch; got != "event: css\ndata: reload\n\n" {
+		t.Errorf("first event = %q, want the reload", got)
+	}
+	warning := <-ch
+	if warning != "event: build-warning\ndata: compiled CSS is out of date\n\n" {
+		t.Errorf("second event = %q, want the warning", warning)
+	}
+
+	// Browsers reloading after the build see the warning again
+	late := make(chan string, 4)
+	s.addClient(late)
+	if got := <-late; got != warning {
+		t.Errorf("late client got %q, want %q", got, warning)
+	}
+
+	s.Warn("")
+	s.notifyClients(reloadCSS)
+	<-ch
+	if s.lastWarning != "" || len(ch) != 0 {
+		t.Error("warning not cleared by a build without one")
+	}
+}
+
+type locatedError struct{}
+
+func (locatedError) Error() string           { return "bad date" }
+func (locatedError) Location() (string, int) { return "posts/a.md", 3 }
+
+func TestDescribeError(t *testing.T) {
+	got := describeError(fmt.Errorf("parse posts: %w", locatedError{}))
+	if got.File != "posts/a.md" || got.Line != 3 || got.Message != "parse posts: bad date" {
+		t.Errorf("describeError = %+v", got)
+	}
+	if got := describeError(errors.New("scss: exit status 1")); got.File != "" || got.Line != 0 {
+		t.Errorf("describeError without location = %+v", got)
+	}
+}
+
+func TestReloadKind(t *testing.T) {
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{[]string{"styles/theme.scss"}, reloadCSS},
+		{[]string{"styles/theme.scss", "static/css/extra.css"}, reloadCSS},
+		{[]string{"content/posts/a.md"}, reloadPage},
+		{[]string{"styles/theme.scss", "content/images/a.png"}, reloadPage},
+		{[]string{"content/posts/a.md", "templates/base.html"}, reloadFull},
+		{[]string{"content/posts"}, reloadFull},
+		{nil, reloadFull},
+	}
+	for _, tt := range tests {
+		paths := make(map[string]bool)
+		for _, p := range tt.paths {
+			paths[p] = true
+		}
+		if got := reloadKind(paths); got != tt.want {
+			t.Errorf("reloadKind(%q) = %q, want %q", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func TestFailedBuildChangesCarryOver(t *testing.T) {
+	fail := true
+	s := &Server{
+		Debounce: 5 * time.Millisecond,
+		BuildFn: func() error {
+			if fail {
+				return errors.New("broken")
+			}
+			return nil
+		},
+	}
+	ch := make(chan string, 4)
+	s.addClient(ch)
+	changes := make(chan string, 1)
+	done := make(chan struct{})
+	go func() {
+		s.buildOnChange(changes)
+		close(done)
+	}()
+
+	s.queueChange(changes, "templates/base.html")
+	if got := <-ch; !strings.HasPrefix(got, "event: build-error\n") {
+		t.Fatalf("event = %q, want build-error", got)
+	}
+
+	// Fixing a stylesheet still needs a full reload for the template
+	fail = false
+	s.queueChange(changes, "styles/theme.scss")
+	if got := <-ch; got != sseEvent(reloadFull, "reload") {
+		t.Errorf("event = %q, want full reload", got)
+	}
+	s.queueChange(changes, "styles/theme.scss")
+	if got := <-ch; got != sseEvent(reloadCSS, "reload") {
+		t.Errorf("event = %q, want css reload", got)
+	}
+
+	close(changes)
+	<-done
+}
+
+func TestServesSwappedFS(t *testing.T) {
+	s := &Server{DistDir: t.TempDir()}
+	handler := s.Handler()
+
+	files := dist.NewMem()
+	files.WriteFile("index.html", []byte("<h1>from memory</h1>"))
+	files.WriteFile("index.html.gz", []byte("gzip bytes"))
+	s.SetFS(files)
+
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Body.String() != "<h1>from memory</h1>" {
+		t.Errorf("body = %q", w.Body.String())
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Body.String() != "gzip bytes" || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("compressed body = %q, encoding %q", w.Body.String(), w.Header().Get("Content-Encoding"))
+	}
+
+	// A new build replaces the old files entirely
+	next := dist.NewMem()
+	next.WriteFile("about/index.html", []byte("about"))
+	s.SetFS(next)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "from memory") {
+		t.Errorf("after swap: status %d, body %q", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/about/", nil))
+	if w.Body.String() != "about" {
+		t.Errorf("about body = %q", w.Body.String())
+	}
+}
@@ -0,0 +1,163 @@
+package templates
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+
+	"billiemuk/internal/content"
+
+	"github.com/yuin/goldmark"
+)
+
+// Named layouts accepted by dateFormat in addition to Go layout strings.
+var dateFormats = map[string]string{
+	"long":  "2 January 2006",
+	"short": "2 January",
+	"iso":   "2006-01-02",
+	"rfc":   time.RFC1123Z,
+}
+
+func (r *Renderer) funcMap() template.FuncMap {
+	return template.FuncMap{
+		"absURL":        r.absURL,
+		"relURL":        r.relURL,
+		"asset":         r.asset,
+		"integrity":     r.integrity,
+		"image":         r.image,
+		"placeholder":   r.placeholder,
+		"truncateWords": truncateWords,
+		"markdownify":   markdownify,
+		"dateFormat":    dateFormat,
+		"jsonLD":        r.jsonLD,
+	}
+}
+
+// absURL joins path onto the site's base URL. Paths that are already
+// absolute URLs are returned unchanged.
+func (r *Renderer) absURL(path string) string {
+	if isAbsURL(path) {
+		return path
+	}
+	return strings.TrimRight(r.baseURL, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
+// relURL returns path rooted at the base URL's path, so the site keeps
+// working when served from a subdirectory.
+func (r *Renderer) relURL(path string) string {
+	if isAbsURL(path) {
+		return path
+	}
+	prefix := ""
+	if u, err := url.Parse(r.baseURL); err == nil {
+		prefix = strings.TrimRight(u.Path, "/")
+	}
+	return prefix + "/" + strings.TrimLeft(path, "/")
+}
+
+// asset returns the published URL of a file under static/, e.g.
+// "css/theme.min.css".
+func (r *Renderer) asset(name string) string {
+	name = strings.TrimLeft(name, "/")
+	if a, ok := r.Assets[name]; ok {
+		name = a.Path
+	}
+	return r.relURL("static/" + name)
+}
+
+// integrity returns the Subresource Integrity hash of a file under static/,
+// or "" when it is unknown.
+func (r *Renderer) integrity(name string) string {
+	return r.Assets[strings.TrimLeft(name, "/")].Integrity
+}
+
+// image returns the size, dominant colour and placeholder of a processed
+// image, e.g. "images/cover.jpg". Unknown images have a zero value.
+func (r *Renderer) image(name string) content.Image {
+	return r.Images[strings.TrimLeft(name, "/")]
+}
+
+// placeholder returns an inline style showing a processed image's blurred
+// placeholder until it loads, for use as style="{{placeholder "images/cover.jpg"}}".
+func (r *Renderer) placeholder(name string) template.CSS {
+	return template.CSS(r.image(name).PlaceholderStyle())
+}
+
+func isAbsURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != ""
+}
+
+// truncateWords shortens s to at most n words, adding an ellipsis when
+// anything was removed. The argument order suits pipelines:
+// {{.Summary | truncateWords 20}}.
+func truncateWords(n int, s string) string {
+	words := strings.Fields(s)
+	if len(words) <= n {
+		return strings.Join(words, " ")
+	}
+	return strings.Join(words[:n], " ") + "…"
+}
+
+// markdownify renders inline markdown. A single wrapping paragraph is
+// removed so the result can sit inside headings and other inline contexts.
+func markdownify(s string) (template.HTML, error) {
+	var buf bytes.Buffer
+	if err := goldmark.Convert([]byte(s), &buf); err != nil {
+		return "", err
+	}
+	out := strings.TrimSpace(buf.String())
+	if strings.HasPrefix(out, "<p>") && strings.HasSuffix(out, "</p>") && strings.Count(out, "<p>") == 1 {
+		out = strings.TrimSuffix(strings.TrimPrefix(out, "<p>"), "</p>")
+	}
+	return template.HTML(out), nil
+}
+
+// dateFormat formats t using a named layout ("long", "short", "iso", "rfc")
+// or any Go layout string.
+func dateFormat(layout string, t time.Time) string {
+	if named, ok := dateFormats[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout)
+}
+
+// jsonLD returns a structured data script describing the page: a
+// BlogPosting for posts and a WebSite otherwise.
+func (r *Renderer) jsonLD(data PageData) (template.HTML, error) {
+	var doc map[string]any
+	if p := data.Post; p != nil {
+		doc = map[string]any{
+			"@context":      "https://schema.org",
+			"@type":         "BlogPosting",
+			"headline":      p.Title,
+			"datePublished": p.Date.Format("2006-01-02"),
+			"url":           r.absURL("/posts/" + p.Slug + "/"),
+			"author":        map[string]any{"@type": "Person", "name": data.Site.Author},
+		}
+		if p.Summary != "" {
+			doc["description"] = p.Summary
+		}
+		if len(p.Tags) > 0 {
+			doc["keywords"] = strings.Join(p.Tags, ", ")
+		}
+	} else {
+		doc = map[string]any{
+			"@context": "https://schema.org",
+			"@type":    "WebSite",
+			"name":     data.Site.Title,
+			"url":      r.absURL("/"),
+		}
+	}
+
+	// json.Marshal escapes <, > and &, so the output cannot close the
+	// script element early.
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(`<script type="application/ld+json">` + string(b) + `</script>`), nil
+}
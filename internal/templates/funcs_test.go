@@ -0,0 +1,168 @@
+package templates
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"billiemuk/internal/content"
+)
+
+func TestAbsURL(t *testing.T) {
+	r := &Renderer{baseURL: "https://example.com/"}
+	tests := []struct {
+		in, want string
+	}{
+		{"/posts/hello/", "https://example.com/posts/hello/"},
+		{"feed.xml", "https://example.com/feed.xml"},
+		{"https://other.example/x", "https://other.example/x"},
+	}
+	for _, tt := range tests {
+		if got := r.absURL(tt.in); got != tt.want {
+			t.Errorf("absURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRelURL(t *testing.T) {
+	tests := []struct {
+		base, in, want string
+	}{
+		{"https://example.com", "/posts/hello/", "/posts/hello/"},
+		{"https://example.com/blog/", "posts/hello/", "/blog/posts/hello/"},
+		{"https://example.com/blog", "https://other.example/x", "https://other.example/x"},
+	}
+	for _, tt := range tests {
+		r := &Renderer{baseURL: tt.base}
+		if got := r.relURL(tt.in); got != tt.want {
+			t.Errorf("relURL(%q) with base %q = %q, want %q", tt.in, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestAsset(t *testing.T) {
+	r := &Renderer{
+		baseURL: "https://example.com",
+		Assets: map[string]Asset{
+			"css/theme.min.css": {Path: "css/theme.min.3fa9c2.css", Integrity: "sha384-abc"},
+		},
+	}
+	if got := r.asset("css/theme.min.css"); got != "/static/css/theme.min.3fa9c2.css" {
+		t.Errorf("asset = %q, want fingerprinted path", got)
+	}
+	if got := r.asset("/img/logo.svg"); got != "/static/img/logo.svg" {
+		t.Errorf("asset = %q, want /static/img/logo.svg", got)
+	}
+	if got := r.integrity("css/theme.min.css"); got != "sha384-abc" {
+		t.Errorf("integrity = %q, want sha384-abc", got)
+	}
+	if got := r.integrity("img/logo.svg"); got != "" {
+		t.Errorf("integrity of unknown asset = %q, want empty", got)
+	}
+}
+
+func TestImagePlaceholder(t *testing.T) {
+	r := &Renderer{Images: map[string]content.Image{
+		"images/cover.jpg": {Width: 800, Height: 400, Color: "#112233", Placeholder: "data:image/png;base64,AAAA"},
+	}}
+	if got := r.image("/images/cover.jpg"); got.Width != 800 || got.Color != "#112233" {
+		t.Errorf("image() = %+v", got)
+	}
+	if got := string(r.placeholder("images/cover.jpg")); !strings.Contains(got, "background-image:url(data:image/png;base64,AAAA)") {
+		t.Errorf("placeholder() = %q", got)
+	}
+	if got := r.placeholder("images/missing.jpg"); got != "" {
+		t.Errorf("placeholder() for unknown image = %q, want empty", got)
+	}
+}
+
+func TestTruncateWords(t *testing.T) {
+	tests := []struct {
+		n        int
+		in, want string
+	}{
+		{3, "one two three four", "one two three…"},
+		{3, "one  two", "one two"},
+		{0, "one", "…"},
+	}
+	for _, tt := range tests {
+		if got := truncateWords(tt.n, tt.in); got != tt.want {
+			t.Errorf("truncateWords(%d, %q) = %q, want %q", tt.n, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestMarkdownify(t *testing.T) {
+	got, err := markdownify("Hello **world**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Hello <strong>world</strong>" {
+		t.Errorf("markdownify inline = %q", got)
+	}
+
+	got, err = markdownify("One\n\nTwo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "<p>One</p>\n<p>Two</p>" {
+		t.Errorf("markdownify paragraphs = %q", got)
+	}
+}
+
+func TestDateFormat(t *testing.T) {
+	d := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		layout, want string
+	}{
+		{"long", "5 January 2026"},
+		{"short", "5 January"},
+		{"iso", "2026-01-05"},
+		{"Jan 2006", "Jan 2026"},
+	}
+	for _, tt := range tests {
+		if got := dateFormat(tt.layout, d); got != tt.want {
+			t.Errorf("dateFormat(%q) = %q, want %q", tt.layout, got, tt.want)
+		}
+	}
+}
+
+func TestJSONLD(t *testing.T) {
+	r := &Renderer{baseURL: "https://example.com"}
+
+	got, err := r.jsonLD(PageData{
+		Site: SiteData{Title: "Test Site", Author: "Billie"},
+		Post: &PostData{
+			Title: "</script><b>",
+			Slug:  "hello",
+			Date:  time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := string(got)
+	checks := []string{
+		`<script type="application/ld+json">`,
+		`"@type":"BlogPosting"`,
+		`"url":"https://example.com/posts/hello/"`,
+		`"datePublished":"2026-01-15"`,
+		`</script>`,
+	}
+	for _, check := range checks {
+		if !strings.Contains(html, check) {
+			t.Errorf("jsonLD missing %q in %s", check, html)
+		}
+	}
+	if strings.Count(html, "</script>") != 1 {
+		t.Errorf("jsonLD did not escape title: %s", html)
+	}
+
+	got, err = r.jsonLD(PageData{Site: SiteData{Title: "Test Site"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(got), `"@type":"WebSite"`) {
+		t.Errorf("jsonLD for non-post page = %s, want WebSite", got)
+	}
+}
@@ -5,7 +5,11 @@ import (
 	"fmt"
 	"html/template"
 	"path/filepath"
+	"sort"
+	"strings"
 	"time"
+
+	"billiemuk/internal/content"
 )
 
 type Social struct {
@@ -26,53 +30,154 @@ type PostData struct {
 	Date        time.Time
 	Summary     string
 	Slug        string
+	Tags        []string
 	Draft       bool
 	HTMLContent template.HTML
+
+	// Series is set when the post belongs to a multi-part series.
+	// SeriesPart is the 1-based position of the post within it.
+	Series     *SeriesData
+	SeriesPart int
+	SeriesPrev *PostData
+	SeriesNext *PostData
+}
+
+type SeriesData struct {
+	Name  string
+	Slug  string
+	Posts []PostData
+}
+
+// Asset is a published static file: its fingerprinted path relative to
+// static/ and its Subresource Integrity hash.
+type Asset struct {
+	Path      string `json:"path"`
+	Integrity string `json:"integrity"`
+}
+
+type ArchiveYear struct {
+	Year   int
+	Months []ArchiveMonth
+}
+
+type ArchiveMonth struct {
+	Month time.Month
+	Posts []PostData
 }
 
 type PageData struct {
 	Site    SiteData
+	Title   string
+	Path    string
 	Posts   []PostData
 	Post    *PostData
+	Series  *SeriesData
+	Archive []ArchiveYear
 	DevMode bool
+	// GIFPlayer includes the script that plays click-to-play animations.
+	GIFPlayer bool
+
+	// PrevPost and NextPost are the chronologically older and newer
+	// neighbours of Post. Related lists posts with similar tags or content.
+	PrevPost *PostData
+	NextPost *PostData
+	Related  []PostData
 }
 
+// Renderer holds one template set per layout. Every top-level *.html file
+// in the templates directories other than base.html is a layout, parsed
+// together with base.html and any shared partials in partials/.
 type Renderer struct {
-	homeTemplate *template.Template
-	postTemplate *template.Template
+	// Assets maps paths under static/ to their fingerprinted versions, for
+	// the asset and integrity template functions. Unlisted paths are
+	// published as-is.
+	Assets map[string]Asset
+	// Images describes processed images by path under the content
+	// directory, for the image and placeholder template functions.
+	Images map[string]content.Image
+
+	// baseURL is used by the absURL, relURL and asset template functions,
+	// and should match the Site.BaseURL of the pages rendered.
+	baseURL string
+	layouts map[string]*template.Template
 }
 
-func New(templatesDir string) (*Renderer, error) {
-	base := filepath.Join(templatesDir, "base.html")
+// New loads templates from one or more directories. Directories are
+// layered in order, so a file in a later directory (such as the site's own
+// templates) overrides the file with the same name in an earlier one (such
+// as a theme). Missing directories are skipped. baseURL is the site's base
+// URL, used to build absolute and subdirectory-relative links.
+func New(baseURL string, templatesDirs ...string) (*Renderer, error) {
+	files := make(map[string]string)
+	for _, dir := range templatesDirs {
+		if dir == "" {
+			continue
+		}
+		for _, pattern := range []string{"*.html", filepath.Join("partials", "*.html")} {
+			matches, err := filepath.Glob(filepath.Join(dir, pattern))
+			if err != nil {
+				return nil, fmt.Errorf("find templates: %w", err)
+			}
+			for _, path := range matches {
+				rel, _ := filepath.Rel(dir, path)
+				files[filepath.ToSlash(rel)] = path
+			}
+		}
+	}
+
+	base, ok := files["base.html"]
+	if !ok {
+		return nil, fmt.Errorf("base template: base.html not found in %s", strings.Join(templatesDirs, ", "))
+	}
 
-	homeTmpl, err := template.ParseFiles(base, filepath.Join(templatesDir, "home.html"))
-	if err != nil {
-		return nil, fmt.Errorf("parse home template: %w", err)
+	var partials, layouts []string
+	for rel, path := range files {
+		switch {
+		case rel == "base.html":
+		case strings.HasPrefix(rel, "partials/"):
+			partials = append(partials, path)
+		default:
+			layouts = append(layouts, path)
+		}
 	}
+	sort.Strings(partials)
 
-	postTmpl, err := template.ParseFiles(base, filepath.Join(templatesDir, "post.html"))
-	if err != nil {
-		return nil, fmt.Errorf("parse post template: %w", err)
+	r := &Renderer{baseURL: baseURL, layouts: make(map[string]*template.Template)}
+	for _, file := range layouts {
+		name := strings.TrimSuffix(filepath.Base(file), ".html")
+
+		set := append([]string{base}, partials...)
+		set = append(set, file)
+		tmpl, err := template.New(filepath.Base(base)).Funcs(r.funcMap()).ParseFiles(set...)
+		if err != nil {
+			return nil, fmt.Errorf("parse %s layout: %w", name, err)
+		}
+		r.layouts[name] = tmpl
 	}
 
-	return &Renderer{
-		homeTemplate: homeTmpl,
-		postTemplate: postTmpl,
-	}, nil
+	return r, nil
 }
 
-func (r *Renderer) RenderHome(data PageData) (string, error) {
-	var buf bytes.Buffer
-	if err := r.homeTemplate.Execute(&buf, data); err != nil {
-		return "", fmt.Errorf("render home: %w", err)
+// Layouts returns the names of all available layouts, sorted.
+func (r *Renderer) Layouts() []string {
+	names := make([]string, 0, len(r.layouts))
+	for name := range r.layouts {
+		names = append(names, name)
 	}
-	return buf.String(), nil
+	sort.Strings(names)
+	return names
 }
 
-func (r *Renderer) RenderPost(data PageData) (string, error) {
+// Render executes the named layout with data.
+func (r *Renderer) Render(layout string, data PageData) (string, error) {
+	tmpl, ok := r.layouts[layout]
+	if !ok {
+		return "", fmt.Errorf("unknown layout %q (available: %s)", layout, strings.Join(r.Layouts(), ", "))
+	}
+
 	var buf bytes.Buffer
-	if err := r.postTemplate.Execute(&buf, data); err != nil {
-		return "", fmt.Errorf("render post: %w", err)
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("render %s: %w", layout, err)
 	}
 	return buf.String(), nil
 }
@@ -1,6 +1,8 @@
 package templates
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -8,7 +10,7 @@ import (
 
 func TestRenderHome(t *testing.T) {
 	dir := "../../templates"
-	renderer, err := New(dir)
+	renderer, err := New("https://example.com", dir)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -33,7 +35,7 @@ func TestRenderHome(t *testing.T) {
 		},
 	}
 
-	html, err := renderer.RenderHome(data)
+	html, err := renderer.Render("home", data)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -77,7 +79,7 @@ func TestRenderHome(t *testing.T) {
 
 func TestRenderPost(t *testing.T) {
 	dir := "../../templates"
-	renderer, err := New(dir)
+	renderer, err := New("https://example.com", dir)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -97,7 +99,7 @@ func TestRenderPost(t *testing.T) {
 		},
 	}
 
-	html, err := renderer.RenderPost(data)
+	html, err := renderer.Render("post", data)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -117,3 +119,212 @@ func TestRenderPost(t *testing.T) {
 		}
 	}
 }
+
+func TestRenderSeries(t *testing.T) {
+	renderer, err := New("https://example.com", "../../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := &SeriesData{
+		Name: "Go Tour",
+		Slug: "go-tour",
+		Posts: []PostData{
+			{Title: "Part One", Slug: "2026-01-10-part-one", Date: time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC)},
+			{Title: "Part Two", Slug: "2026-01-12-part-two", Date: time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+	html, err := renderer.Render("series", PageData{
+		Site:   SiteData{Title: "Test Site", BaseURL: "https://example.com"},
+		Series: series,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []string{
+		"Go Tour",
+		"/series/go-tour/",
+		"/posts/2026-01-10-part-one/",
+		"/posts/2026-01-12-part-two/",
+	}
+	for _, check := range checks {
+		if !strings.Contains(html, check) {
+			t.Errorf("series HTML missing %q", check)
+		}
+	}
+}
+
+func TestRenderPostNavigation(t *testing.T) {
+	renderer, err := New("https://example.com", "../../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)
+	html, err := renderer.Render("post", PageData{
+		Site:     SiteData{Title: "Test Site", BaseURL: "https://example.com"},
+		Post:     &PostData{Title: "Middle", Slug: "middle", Date: date},
+		PrevPost: &PostData{Title: "Older", Slug: "older", Date: date},
+		NextPost: &PostData{Title: "Newer", Slug: "newer", Date: date},
+		Related:  []PostData{{Title: "Similar", Slug: "similar", Date: date}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []string{
+		`href="/posts/older/" rel="prev"`,
+		`href="/posts/newer/" rel="next"`,
+		"Related posts",
+		"/posts/similar/",
+	}
+	for _, check := range checks {
+		if !strings.Contains(html, check) {
+			t.Errorf("post HTML missing %q", check)
+		}
+	}
+}
+
+func TestGIFPlayerOnlyWhenNeeded(t *testing.T) {
+	renderer, err := New("https://example.com", "../../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := PageData{
+		Site: SiteData{Title: "Test Site", BaseURL: "https://example.com"},
+		Post: &PostData{Title: "Still", Slug: "still", Date: time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)},
+	}
+	html, err := renderer.Render("post", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(html, ".gif-player a") {
+		t.Error("post without animations includes the GIF player script")
+	}
+
+	data.GIFPlayer = true
+	html, err = renderer.Render("post", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(html, ".gif-player a") {
+		t.Error("post with animations is missing the GIF player script")
+	}
+}
+
+func TestRenderArchive(t *testing.T) {
+	renderer, err := New("https://example.com", "../../templates")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := renderer.Render("archive", PageData{
+		Site:  SiteData{Title: "Test Site", BaseURL: "https://example.com"},
+		Title: "Archive",
+		Path:  "/archive/",
+		Archive: []ArchiveYear{{
+			Year: 2026,
+			Months: []ArchiveMonth{{
+				Month: time.January,
+				Posts: []PostData{{Title: "First Post", Slug: "2026-01-15-first-post", Date: time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC)}},
+			}},
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checks := []string{
+		"https://example.com/archive/",
+		`href="/2026/"`,
+		"January",
+		"/posts/2026-01-15-first-post/",
+	}
+	for _, check := range checks {
+		if !strings.Contains(html, check) {
+			t.Errorf("archive HTML missing %q", check)
+		}
+	}
+}
+
+func TestRenderCustomLayout(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"base.html":            `<main>{{block "content" .}}{{end}}</main>`,
+		"post.html":            `{{define "content"}}post{{end}}`,
+		"wide.html":            `{{define "content"}}{{template "byline" .}} wide {{.Post.Title}}{{end}}`,
+		"partials/byline.html": `{{define "byline"}}by {{.Site.Author}}{{end}}`,
+	}
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	renderer, err := New("https://example.com", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(renderer.Layouts(), ","); got != "post,wide" {
+		t.Errorf("layouts = %q, want %q", got, "post,wide")
+	}
+
+	html, err := renderer.Render("wide", PageData{
+		Site: SiteData{Author: "Billie"},
+		Post: &PostData{Title: "Hello"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != "<main>by Billie wide Hello</main>" {
+		t.Errorf("html = %q", html)
+	}
+
+	_, err = renderer.Render("missing", PageData{})
+	if err == nil {
+		t.Fatal("expected error for unknown layout")
+	}
+	if !strings.Contains(err.Error(), "available: post, wide") {
+		t.Errorf("error = %q, want list of available layouts", err)
+	}
+}
+
+func TestNewLayersThemeTemplates(t *testing.T) {
+	root := t.TempDir()
+	theme := filepath.Join(root, "theme")
+	site := filepath.Join(root, "site")
+	files := map[string]string{
+		filepath.Join(theme, "base.html"):               `<main>{{block "content" .}}{{end}}</main>`,
+		filepath.Join(theme, "post.html"):               `{{define "content"}}theme post {{template "footer" .}}{{end}}`,
+		filepath.Join(theme, "partials", "footer.html"): `{{define "footer"}}theme footer{{end}}`,
+		filepath.Join(site, "partials", "footer.html"):  `{{define "footer"}}site footer{{end}}`,
+	}
+	for path, src := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(src), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	renderer, err := New("https://example.com", theme, site)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	html, err := renderer.Render("post", PageData{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if html != "<main>theme post site footer</main>" {
+		t.Errorf("html = %q, want theme layout with site partial", html)
+	}
+}
@@ -1,20 +1,41 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"billiemuk/internal/builder"
 	"billiemuk/internal/content"
+	"billiemuk/internal/dist"
 	"billiemuk/internal/server"
 	"billiemuk/internal/templates"
 )
 
+type buildOptions struct {
+	IncludeDrafts bool
+	DevMode       bool
+	Theme         string
+	SCSS          string
+	Verbose       bool
+	NoMinify      bool
+	Precompress   bool
+	Jobs          int
+	Report        string
+	Images        builder.ImageConfig
+	SanitizeSVG   bool
+	Budget        builder.Budget
+	// Output receives the build instead of dist/ when set.
+	Output dist.Writer
+}
+
 func main() {
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: billiemuk <build|serve|new> [args]")
+		fmt.Println("Usage: billiemuk <build|serve|new|css> [args]")
 		os.Exit(1)
 	}
 
@@ -26,13 +47,50 @@ func main() {
 
 	switch os.Args[1] {
 	case "build":
-		if err := runBuild(root, false, false); err != nil {
+		opts := buildOptions{Images: builder.ImageConfig{JPEGQuality: builder.DefaultJPEGQuality}}
+		fs := flag.NewFlagSet("build", flag.ExitOnError)
+		fs.StringVar(&opts.Theme, "theme", "", "theme name under themes/")
+		fs.StringVar(&opts.SCSS, "scss", "warn", "stale SCSS handling: ignore, warn, fail or compile")
+		fs.BoolVar(&opts.Verbose, "v", false, "list every static asset emitted")
+		fs.BoolVar(&opts.NoMinify, "no-minify", false, "write generated HTML, XML and JSON unminified")
+		fs.BoolVar(&opts.Precompress, "precompress", false, "write .gz and .br siblings for text files")
+		fs.IntVar(&opts.Jobs, "j", 0, "pages and images to process in parallel (default: one per CPU)")
+		fs.IntVar(&opts.Images.MaxWidth, "image-width", builder.DefaultImageMaxWidth, "scale images wider than this down to it (0 keeps full size)")
+		fs.Var(qualityFlag{&opts.Images.JPEGQuality}, "jpeg-quality", "JPEG quality for re-encoded images (1-100)")
+		fs.BoolVar(&opts.Images.GIFPosters, "gif-posters", true, "write a poster frame for animated GIFs and show them click-to-play")
+		fs.BoolVar(&opts.SanitizeSVG, "sanitize-svg", false, "strip scripts, foreignObject and event handlers from SVGs")
+		fs.StringVar(&opts.Report, "report", "text", "build report format: text, json or none")
+		fs.Var(sizeFlag{&opts.Budget.MaxPageBytes}, "max-page", "fail if any HTML page is larger than this (e.g. 100KB)")
+		fs.Var(sizeFlag{&opts.Budget.MaxImageBytes}, "max-image", "fail if any image is larger than this (e.g. 500KB)")
+		fs.Var(sizeFlag{&opts.Budget.MaxPageWeight}, "max-weight", "fail if any page plus its CSS, scripts and images is larger than this (e.g. 1MB)")
+		fs.Parse(os.Args[2:])
+
+		// The report is printed even when the build is over budget, so CI
+		// logs show the offenders alongside the totals.
+		report, err := runBuild(root, opts)
+		if report != nil {
+			if perr := printReport(report, opts); perr != nil && err == nil {
+				err = perr
+			}
+		}
+		if err != nil {
 			fmt.Fprintf(os.Stderr, "build error: %v\n", err)
 			os.Exit(1)
 		}
-		fmt.Println("Build complete: dist/")
 	case "serve":
-		if err := runServe(root); err != nil {
+		opts := buildOptions{IncludeDrafts: true, DevMode: true, Images: builder.ImageConfig{JPEGQuality: builder.DefaultJPEGQuality}}
+		fs := flag.NewFlagSet("serve", flag.ExitOnError)
+		fs.StringVar(&opts.Theme, "theme", "", "theme name under themes/")
+		fs.StringVar(&opts.SCSS, "scss", "warn", "stale SCSS handling: ignore, warn, fail or compile")
+		fs.BoolVar(&opts.Precompress, "precompress", false, "write and serve .gz and .br siblings for text files")
+		fs.IntVar(&opts.Jobs, "j", 0, "pages and images to process in parallel (default: one per CPU)")
+		fs.IntVar(&opts.Images.MaxWidth, "image-width", builder.DefaultImageMaxWidth, "scale images wider than this down to it (0 keeps full size)")
+		fs.Var(qualityFlag{&opts.Images.JPEGQuality}, "jpeg-quality", "JPEG quality for re-encoded images (1-100)")
+		fs.BoolVar(&opts.Images.GIFPosters, "gif-posters", true, "write a poster frame for animated GIFs and show them click-to-play")
+		fs.BoolVar(&opts.SanitizeSVG, "sanitize-svg", false, "strip scripts, foreignObject and event handlers from SVGs")
+		fs.Parse(os.Args[2:])
+
+		if err := runServe(root, opts); err != nil {
 			fmt.Fprintf(os.Stderr, "serve error: %v\n", err)
 			os.Exit(1)
 		}
@@ -45,6 +103,12 @@ func main() {
 			fmt.Fprintf(os.Stderr, "error: %v\n", err)
 			os.Exit(1)
 		}
+	case "css":
+		if err := builder.CompileSCSS(filepath.Join(root, "static"), scssLoadPaths(root)); err != nil {
+			fmt.Fprintf(os.Stderr, "css error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Compiled static/scss into static/css/")
 	default:
 		fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
 		os.Exit(1)
@@ -64,17 +128,150 @@ func siteConfig() templates.SiteData {
 	}
 }
 
-func runBuild(root string, includeDrafts, devMode bool) error {
+func themeDir(root, theme string) (string, error) {
+	if theme == "" {
+		return "", nil
+	}
+	dir := filepath.Join(root, "themes", theme)
+	if _, err := os.Stat(dir); err != nil {
+		return "", fmt.Errorf("theme %q: %w", theme, err)
+	}
+	return dir, nil
+}
+
+func scssLoadPaths(root string) []string {
+	return []string{filepath.Join(root, "node_modules")}
+}
+
+func scssMode(s string) (builder.SCSSMode, error) {
+	switch s {
+	case "ignore":
+		return builder.SCSSIgnore, nil
+	case "warn":
+		return builder.SCSSWarn, nil
+	case "fail":
+		return builder.SCSSFail, nil
+	case "compile":
+		return builder.SCSSCompile, nil
+	}
+	return "", fmt.Errorf("unknown --scss mode %q", s)
+}
+
+// sizeFlag parses a byte count with an optional B, KB or MB suffix.
+type sizeFlag struct{ n *int }
+
+func (f sizeFlag) String() string {
+	if f.n == nil || *f.n == 0 {
+		return ""
+	}
+	return strconv.Itoa(*f.n)
+}
+
+func (f sizeFlag) Set(s string) error {
+	units := []struct {
+		suffix string
+		scale  float64
+	}{{"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+	num, scale := strings.ToUpper(strings.TrimSpace(s)), 1.0
+	for _, u := range units {
+		if strings.HasSuffix(num, u.suffix) {
+			num, scale = strings.TrimSpace(strings.TrimSuffix(num, u.suffix)), u.scale
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*f.n = int(v * scale)
+	return nil
+}
+
+// qualityFlag parses a JPEG quality, rejecting values a sidecar would.
+type qualityFlag struct{ q *int }
+
+func (f qualityFlag) String() string {
+	if f.q == nil {
+		return ""
+	}
+	return strconv.Itoa(*f.q)
+}
+
+func (f qualityFlag) Set(s string) error {
+	q, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("invalid quality %q", s)
+	}
+	if err := builder.CheckJPEGQuality(q); err != nil {
+		return err
+	}
+	*f.q = q
+	return nil
+}
+
+func runBuild(root string, opts buildOptions) (*builder.Report, error) {
+	theme, err := themeDir(root, opts.Theme)
+	if err != nil {
+		return nil, err
+	}
+	scss, err := scssMode(opts.SCSS)
+	if err != nil {
+		return nil, err
+	}
 	cfg := builder.Config{
 		ContentDir:    filepath.Join(root, "content"),
 		TemplatesDir:  filepath.Join(root, "templates"),
 		StaticDir:     filepath.Join(root, "static"),
 		DistDir:       filepath.Join(root, "dist"),
+		ThemeDir:      theme,
 		Site:          siteConfig(),
-		IncludeDrafts: includeDrafts,
-		DevMode:       devMode,
+		IncludeDrafts: opts.IncludeDrafts,
+		DevMode:       opts.DevMode,
+		Minify:        !opts.NoMinify,
+		Precompress:   opts.Precompress,
+		Jobs:          opts.Jobs,
+		SanitizeSVG:   opts.SanitizeSVG,
+		Images:        opts.Images,
+		Budget:        opts.Budget,
+		Output:        opts.Output,
+		SCSS:          scss,
+		SCSSLoadPaths: scssLoadPaths(root),
+	}
+	report, err := builder.Build(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return report, builder.CheckBudget(cfg, report)
+}
+
+// printReport writes the build report to stdout in the format chosen with
+// --report. JSON output is printed alone so it can be piped to other tools.
+func printReport(report *builder.Report, opts buildOptions) error {
+	switch opts.Report {
+	case "json":
+		return report.WriteJSON(os.Stdout)
+	case "text", "none":
+	default:
+		return fmt.Errorf("unknown --report format %q", opts.Report)
+	}
+	fmt.Println("Build complete: dist/")
+	if opts.Verbose {
+		printAssets(report.Assets)
+	}
+	if opts.Report == "text" {
+		return report.WriteText(os.Stdout)
+	}
+	return nil
+}
+
+func printAssets(assets []builder.AssetResult) {
+	for _, a := range assets {
+		if a.Action == builder.AssetExcluded {
+			fmt.Printf("  %-8s %s\n", a.Action, a.Source)
+			continue
+		}
+		fmt.Printf("  %-8s %s -> %s (%d -> %d bytes)\n", a.Action, a.Source, a.Output, a.SourceBytes, a.Bytes)
 	}
-	return builder.Build(cfg)
 }
 
 func runNew(root, title string) error {
@@ -91,18 +288,37 @@ func runNew(root, title string) error {
 	return nil
 }
 
-func runServe(root string) error {
+func runServe(root string, opts buildOptions) error {
+	theme, err := themeDir(root, opts.Theme)
+	if err != nil {
+		return err
+	}
+	watchDirs := []string{
+		filepath.Join(root, "content"),
+		filepath.Join(root, "templates"),
+		filepath.Join(root, "static"),
+	}
+	if theme != "" {
+		watchDirs = append(watchDirs, theme)
+	}
+
+	// Builds go to memory and are served only once complete, so a request
+	// during a rebuild never sees missing files
 	s := &server.Server{
-		DistDir: filepath.Join(root, "dist"),
-		BuildFn: func() error {
-			return runBuild(root, true, true)
-		},
-		WatchDirs: []string{
-			filepath.Join(root, "content"),
-			filepath.Join(root, "templates"),
-			filepath.Join(root, "static"),
-		},
-		Addr: ":8080",
+		WatchDirs: watchDirs,
+		Addr:      ":8080",
+	}
+	s.BuildFn = func() error {
+		files := dist.NewMem()
+		buildOpts := opts
+		buildOpts.Output = files
+		report, err := runBuild(root, buildOpts)
+		if err != nil {
+			return err
+		}
+		s.Warn(strings.Join(report.Warnings, "\n"))
+		s.SetFS(files)
+		return nil
 	}
 	return s.Start()
 }